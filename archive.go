@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/mmcdole/gofeed"
+)
+
+// defaultMaxArchivePages bounds the archive walk when max_archive_pages isn't
+// set.
+const defaultMaxArchivePages = 10
+
+// prevArchiveKey is where fetch leaves the document's RFC 5005 prev-archive
+// link in gofeed's Custom map for feeds with follow_archive.
+const prevArchiveKey = "prev-archive"
+
+// prevArchiveLink returns the RFC 5005 prev-archive link of a feed document,
+// resolved against the document's URL, or an empty string when there isn't one.
+func prevArchiveLink(body []byte, docURL *url.URL) string {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok || element.Name.Local != "link" {
+			continue
+		}
+		var rel, href string
+		for _, attr := range element.Attr {
+			switch attr.Name.Local {
+			case "rel":
+				rel = attr.Value
+			case "href":
+				href = attr.Value
+			}
+		}
+		if href != "" && hasRel(rel, "prev-archive") {
+			return resolveURL(docURL.String(), href)
+		}
+	}
+}
+
+// backfillArchive adds the items of the feed's archive documents to rss the
+// first time the feed is synced, walking prev-archive links back from the
+// current document. The walk stops after max_archive_pages documents or once a
+// whole page predates the feed's cutoff.
+func (feed Feed) backfillArchive(rss *gofeed.Feed, redisClient *redis.Client) {
+	prev := rss.Custom[prevArchiveKey]
+	if prev == "" {
+		return
+	}
+	synced, err := redisClient.SCard(context.Background(), feed.ID).Result()
+	if err != nil {
+		log.Printf("Unable to check whether feed %s was synced before, not following its archive: %v", feed.Name, err)
+		return
+	}
+	if synced > 0 {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, item := range rss.Items {
+		seen[itemGUID(item)] = true
+	}
+	cutoff := feed.cutoff()
+	visited := map[string]bool{feed.FeedURL: true}
+	for pages := 0; prev != "" && pages < feed.MaxArchivePages && !visited[prev]; pages++ {
+		visited[prev] = true
+		page, next, err := feed.fetchArchivePage(prev)
+		if err != nil {
+			log.Printf("Unable to fetch archive page %s of feed %s, stopping the backfill: %v", redactURL(prev), feed.Name, err)
+			return
+		}
+
+		recent := false
+		added := 0
+		for _, item := range page.Items {
+			if t := itemTime(item); t == nil || !t.Before(cutoff) {
+				recent = true
+			}
+			if guid := itemGUID(item); !seen[guid] {
+				seen[guid] = true
+				rss.Items = append(rss.Items, item)
+				added++
+			}
+		}
+		log.Printf("Backfilled %d items of feed %s from archive page %s", added, feed.Name, redactURL(prev))
+		if !recent {
+			return
+		}
+		prev = next
+	}
+}
+
+// fetchArchivePage fetches and parses an archive document, returning it along
+// with its own prev-archive link. Archive documents don't change, so no
+// conditional request is made.
+func (feed Feed) fetchArchivePage(pageURL string) (*gofeed.Feed, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), feed.FetchTimeout)
+	defer cancel()
+
+	req, err := feed.newRequest(ctx, pageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := feed.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	decoded, err := decodeBody(resp.Body, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := io.ReadAll(decoded)
+	if err != nil {
+		return nil, "", err
+	}
+	page, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	return page, prevArchiveLink(body, resp.Request.URL), nil
+}
+
+// newRequest builds a GET request for the feed's server with the feed's
+// headers and credentials.
+func (feed Feed) newRequest(ctx context.Context, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		// The parse error quotes the URL verbatim, credentials and all
+		return nil, fmt.Errorf("invalid feed URL %s", redactURL(rawURL))
+	}
+	req.Header.Set("User-Agent", "GitlabRSSSync")
+	// Asking explicitly turns off the transport's transparent gzip handling,
+	// decodeBody takes care of it instead
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	for name, value := range feed.Headers {
+		req.Header.Set(name, value)
+	}
+	if feed.Username != "" {
+		req.SetBasicAuth(feed.Username, feed.Password)
+	}
+	return req, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// resolveAssignees looks up the IDs of each feed's assignee_usernames and
+// combines them with its assignee_ids, and those of the usernames in its
+// author_assignee_map. An unknown username is an error so a typo doesn't
+// silently leave issues unassigned.
+func (config *Config) resolveAssignees(gitlabs gitlabInstances) error {
+	ids := make(map[string]int)
+	for i := range config.Feeds {
+		feed := &config.Feeds[i]
+		resolve := func(username string) (int, error) {
+			// Usernames are per instance
+			key := feed.GitlabBaseURL + " " + username
+			if id, ok := ids[key]; ok {
+				return id, nil
+			}
+			users, _, err := gitlabs.forFeed(*feed).Users.ListUsers(&gitlab.ListUsersOptions{Username: gitlab.String(username)},
+				gitlab.WithContext(context.Background()))
+			if err != nil {
+				return 0, fmt.Errorf("looking up assignee %s of feed %s: %w", username, feed.Name, err)
+			}
+			if len(users) == 0 {
+				return 0, fmt.Errorf("assignee %s of feed %s not found in Gitlab", username, feed.Name)
+			}
+			ids[key] = users[0].ID
+			log.Printf("Resolved assignee %s to user ID %d", username, users[0].ID)
+			return users[0].ID, nil
+		}
+
+		feed.assignees = append([]int(nil), feed.AssigneeIDs...)
+		for _, username := range feed.AssigneeUsernames {
+			id, err := resolve(username)
+			if err != nil {
+				return err
+			}
+			feed.assignees = append(feed.assignees, id)
+		}
+		feed.authorAssignees = make(map[string]int)
+		for author, username := range feed.AuthorAssigneeMap {
+			id, err := resolve(username)
+			if err != nil {
+				return err
+			}
+			feed.authorAssignees[strings.ToLower(author)] = id
+		}
+	}
+	return nil
+}
+
+// itemAssignees returns who the issue for item is assigned to, and their names
+// for logging: the user author_assignee_map gives for the item's author, by
+// name or email, or the feed's assignees.
+func (feed Feed) itemAssignees(item *gofeed.Item) ([]int, []string) {
+	if len(feed.AuthorAssigneeMap) == 0 {
+		return feed.assignees, feed.assigneeNames()
+	}
+	authors := item.Authors
+	if len(authors) == 0 && item.Author != nil {
+		authors = []*gofeed.Person{item.Author}
+	}
+	for _, author := range authors {
+		for _, key := range []string{author.Name, author.Email} {
+			if id, ok := feed.authorAssignees[strings.ToLower(key)]; ok && key != "" {
+				return []int{id}, []string{feed.authorAssigneeUsername(key)}
+			}
+		}
+	}
+	if len(authors) > 0 {
+		unmappedAuthorsCounter.WithLabelValues(feed.Name).Inc()
+		debugf("No assignee mapped for author of '%s' in feed %s, using the feed's", item.Title, feed.Name)
+	}
+	return feed.assignees, feed.assigneeNames()
+}
+
+// authorAssigneeUsername returns the username author_assignee_map gives for
+// an author, whatever the case the map uses.
+func (feed Feed) authorAssigneeUsername(author string) string {
+	for key, username := range feed.AuthorAssigneeMap {
+		if strings.EqualFold(key, author) {
+			return username
+		}
+	}
+	return ""
+}
+
+// assigneeNames describes the feed's assignees for logging, by username where
+// the config gives one.
+func (feed Feed) assigneeNames() []string {
+	names := append([]string(nil), feed.AssigneeUsernames...)
+	for _, id := range feed.AssigneeIDs {
+		names = append(names, strconv.Itoa(id))
+	}
+	return names
+}
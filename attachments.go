@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"golang.org/x/net/html"
+)
+
+// attachment is a file referenced by a feed item, from an enclosure or the
+// Media RSS extension.
+type attachment struct {
+	URL    string
+	Type   string
+	Length int64
+	Image  bool
+}
+
+// itemAttachments collects the item's enclosures and Media RSS content and
+// thumbnails, without duplicates.
+func itemAttachments(item *gofeed.Item) []attachment {
+	var attachments []attachment
+	seen := make(map[string]bool)
+	add := func(a attachment) {
+		if a.URL == "" || seen[a.URL] {
+			return
+		}
+		seen[a.URL] = true
+		if strings.HasPrefix(a.Type, "image/") {
+			a.Image = true
+		}
+		attachments = append(attachments, a)
+	}
+
+	for _, enclosure := range item.Enclosures {
+		length, _ := strconv.ParseInt(enclosure.Length, 10, 64)
+		add(attachment{URL: enclosure.URL, Type: enclosure.Type, Length: length})
+	}
+
+	var walk func(extensions []ext.Extension)
+	walk = func(extensions []ext.Extension) {
+		for _, extension := range extensions {
+			switch extension.Name {
+			case "content":
+				length, _ := strconv.ParseInt(extension.Attrs["fileSize"], 10, 64)
+				add(attachment{
+					URL:    extension.Attrs["url"],
+					Type:   extension.Attrs["type"],
+					Length: length,
+					Image:  extension.Attrs["medium"] == "image",
+				})
+			case "thumbnail":
+				add(attachment{URL: extension.Attrs["url"], Image: true})
+			}
+			for _, children := range extension.Children {
+				walk(children)
+			}
+		}
+	}
+	for _, extensions := range item.Extensions["media"] {
+		walk(extensions)
+	}
+
+	return attachments
+}
+
+// attachmentsSection renders the item's attachments as a Markdown list for the
+// issue description, embedding images so Gitlab shows a preview. It is empty
+// when there are no attachments or include_enclosures is false.
+func (feed Feed) attachmentsSection(item *gofeed.Item) string {
+	if !feed.includesEnclosures() {
+		return ""
+	}
+	attachments := itemAttachments(item)
+	if len(attachments) == 0 {
+		return ""
+	}
+
+	var section strings.Builder
+	section.WriteString("\n\n**Attachments**\n")
+	for _, a := range attachments {
+		var details []string
+		if a.Type != "" {
+			details = append(details, a.Type)
+		}
+		if a.Length > 0 {
+			details = append(details, humanSize(a.Length))
+		}
+		line := fmt.Sprintf("\n- [%s](%s)", attachmentName(a.URL), a.URL)
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, ", ") + ")"
+		}
+		if a.Image {
+			line += fmt.Sprintf("\n\n  ![%s](%s)", attachmentName(a.URL), a.URL)
+		}
+		section.WriteString(line)
+	}
+	return section.String()
+}
+
+// attachmentName is the last path element of an attachment URL.
+func attachmentName(rawURL string) string {
+	name := rawURL
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimRight(name, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" {
+		return rawURL
+	}
+	return name
+}
+
+// humanSize formats a byte count, e.g. 1536 as "1.5 KB".
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// leadImage returns the URL of the first image in the item's content, falling
+// back to its first image attachment. data: URIs are skipped and an empty
+// string is returned when there is no usable image.
+func (feed Feed) leadImage(item *gofeed.Item) string {
+	base := feed.itemBaseURL(item)
+	for _, fragment := range []string{item.Content, item.Description} {
+		if src := firstImageSrc(fragment); src != "" {
+			return resolveURL(base, src)
+		}
+	}
+	for _, a := range itemAttachments(item) {
+		if a.Image && !isDataURI(a.URL) {
+			return resolveURL(base, a.URL)
+		}
+	}
+	return ""
+}
+
+// leadImageSection renders the lead image for the top of the issue description
+// when the feed has lead_image set.
+func (feed Feed) leadImageSection(item *gofeed.Item) string {
+	if !feed.LeadImage {
+		return ""
+	}
+	src := feed.leadImage(item)
+	if src == "" {
+		return ""
+	}
+	return fmt.Sprintf("![%s](%s)\n\n", strings.NewReplacer("[", "", "]", "").Replace(item.Title), src)
+}
+
+// firstImageSrc returns the src of the first <img> in an HTML fragment that
+// isn't a data: URI.
+func firstImageSrc(fragment string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "img" {
+				continue
+			}
+			for _, attr := range token.Attr {
+				if attr.Key == "src" && strings.TrimSpace(attr.Val) != "" && !isDataURI(attr.Val) {
+					return strings.TrimSpace(attr.Val)
+				}
+			}
+		}
+	}
+}
+
+func isDataURI(src string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(src)), "data:")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// issueCreationBudget caps the issues created across all feeds per interval,
+// see max_issues_per_run. It is nil, and lets everything through, when no cap
+// is configured.
+var issueCreationBudget *issueBudget
+
+// issueBudget hands out up to limit issue creations per window.
+type issueBudget struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	start  time.Time
+	used   int
+	warned bool
+}
+
+func newIssueBudget(limit int, window time.Duration) *issueBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &issueBudget{limit: limit, window: window, start: time.Now()}
+}
+
+// take reserves one issue creation, reporting false once the limit for the
+// current window is used up.
+func (b *issueBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now := time.Now(); now.Sub(b.start) >= b.window {
+		b.start, b.used, b.warned = now, 0, false
+	}
+	if b.used < b.limit {
+		b.used++
+		return true
+	}
+	if !b.warned {
+		b.warned = true
+		log.Printf("WARNING: max_issues_per_run of %d reached, new items are deferred until %s",
+			b.limit, b.start.Add(b.window).Format(time.RFC850))
+	}
+	return false
+}
+
+// giveBack returns a creation reserved with take that didn't create an issue.
+func (b *issueBudget) giveBack() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used > 0 {
+		b.used--
+	}
+}
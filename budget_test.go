@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIssueBudget(t *testing.T) {
+	budget := newIssueBudget(2, time.Hour)
+	if !budget.take() || !budget.take() {
+		t.Fatal("budget refused a creation under its limit")
+	}
+	if budget.take() {
+		t.Fatal("budget allowed a creation over its limit")
+	}
+	budget.giveBack()
+	if !budget.take() {
+		t.Error("budget didn't take back a creation that failed")
+	}
+	if budget.take() {
+		t.Error("giving back allowed more than one extra creation")
+	}
+
+	budget.start = time.Now().Add(-2 * time.Hour)
+	if !budget.take() {
+		t.Error("budget wasn't reset after its window")
+	}
+}
+
+func TestNoIssueBudget(t *testing.T) {
+	budget := newIssueBudget(0, time.Hour)
+	for i := 0; i < 10; i++ {
+		if !budget.take() {
+			t.Fatal("budget without a limit refused a creation")
+		}
+	}
+	budget.giveBack()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// isResolved reports whether the updated item matches the feed's
+// close_on_pattern, e.g. a status page incident marked as resolved.
+func (feed Feed) isResolved(item *gofeed.Item) bool {
+	if feed.closePattern == nil {
+		return false
+	}
+	return feed.closePattern.MatchString(item.Title) || feed.closePattern.MatchString(itemBody(item))
+}
+
+// closeIssue closes the item's issue with a note quoting the resolution. Issues
+// that are already closed are left alone. The new content hash is only stored
+// once the issue is closed, so a failure is retried on the next run.
+func (feed Feed) closeIssue(gitlabClient *gitlab.Client, redisClient *redis.Client, item *gofeed.Item, project, iid int) {
+	ctx := gitlab.WithContext(context.Background())
+
+	issue, _, err := gitlabClient.Issues.GetIssue(project, iid, ctx)
+	if err != nil {
+		log.Printf("Unable to read issue #%d in project %d for %s: %v", iid, project, item.Title, err)
+		return
+	}
+	if issue.State == "closed" {
+		debugf("Issue #%d in project %d for '%s' is already closed", iid, project, item.Title)
+		feed.rememberContent(redisClient, item)
+		return
+	}
+
+	noteOptions := &gitlab.CreateIssueNoteOptions{
+		Body: gitlab.String("Resolved in the feed:\n\n" + quote(item.Title+"\n\n"+feed.issueBody(item))),
+	}
+	if _, _, err := gitlabClient.Notes.CreateIssueNote(project, iid, noteOptions, ctx); err != nil {
+		log.Printf("Unable to add resolution note to issue #%d for %s: %v", iid, item.Title, err)
+		return
+	}
+	updateOptions := &gitlab.UpdateIssueOptions{StateEvent: gitlab.String("close")}
+	if _, _, err := gitlabClient.Issues.UpdateIssue(project, iid, updateOptions, ctx); err != nil {
+		log.Printf("Unable to close issue #%d in project %d for %s: %v", iid, project, item.Title, err)
+		return
+	}
+	issuesClosedCounter.WithLabelValues(feed.Name).Inc()
+	log.Printf("Closed issue #%d in project %d as '%s' was resolved", iid, project, item.Title)
+	feed.rememberContent(redisClient, item)
+}
+
+// quote formats text as a Markdown blockquote.
+func quote(text string) string {
+	return "> " + strings.ReplaceAll(strings.TrimSpace(text), "\n", "\n> ")
+}
+
+// closeCreatedIssue closes an issue just created for a feed with state: closed,
+// as Gitlab can't create closed issues. Retroactive feeds date the closing at
+// the item so archived issues read chronologically. It reports whether the
+// issue was closed, a failure is only logged as the item is synced either way.
+func (feed Feed) closeCreatedIssue(gitlabClient *gitlab.Client, issue *gitlab.Issue, itemTime *time.Time) bool {
+	updateOptions := &gitlab.UpdateIssueOptions{StateEvent: gitlab.String("close")}
+	if feed.Retroactive {
+		updateOptions.UpdatedAt = itemTime
+	}
+	if _, _, err := gitlabClient.Issues.UpdateIssue(issue.ProjectID, issue.IID, updateOptions, gitlab.WithContext(context.Background())); err != nil {
+		log.Printf("Unable to close new issue #%d in project %d for feed %s: %v", issue.IID, issue.ProjectID, feed.Name, err)
+		return false
+	}
+	return true
+}
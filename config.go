@@ -0,0 +1,566 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3" // Updated to v3
+)
+
+// defaultFetchTimeout bounds a feed fetch when no fetch_timeout is configured.
+const defaultFetchTimeout = 30 * time.Second
+
+// defaultInterval is the time between runs when interval isn't configured.
+const defaultInterval = 10 * time.Minute
+
+// defaultConcurrency is how many feeds are checked in parallel when
+// concurrency isn't configured.
+const defaultConcurrency = 4
+
+type Config struct {
+	Feeds        []Feed
+	Interval     int
+	FetchTimeout time.Duration `yaml:"fetch_timeout"`
+	// Concurrency is how many feeds are checked in parallel
+	Concurrency int
+	// The first checks of feeds are spread over the interval, Stagger apart and
+	// each delayed by up to Jitter, see schedule
+	Stagger time.Duration
+	Jitter  time.Duration
+	// Subscriptions in OPMLFile are added to Feeds at load time, created in
+	// OPMLProjectID with OPMLLabels.
+	OPMLFile      string   `yaml:"opml_file"`
+	OPMLProjectID int      `yaml:"opml_gitlab_project_id"`
+	OPMLLabels    []string `yaml:"opml_labels"`
+	// TrackingParams are the query parameters stripped from item links,
+	// defaulting to defaultTrackingParams. Feeds can override the list.
+	TrackingParams []string `yaml:"tracking_params"`
+	// MaxIssuesPerRun caps the issues created across all feeds per interval,
+	// the rest are deferred. Zero means no limit.
+	MaxIssuesPerRun int `yaml:"max_issues_per_run"`
+	// LabelDefinitions gives the color, and optionally description and
+	// priority, labels are created with when a project doesn't have them
+	LabelDefinitions map[string]LabelDefinition `yaml:"label_definitions"`
+	// FooterTemplate replaces the "Source:" line ending issue descriptions,
+	// see footerData. Feeds can override it.
+	FooterTemplate string `yaml:"footer_template"`
+	// WebhookSecret enables /webhook/gitlab, authenticating Gitlab's requests
+	// with it as their secret token
+	WebhookSecret string `yaml:"webhook_secret"`
+	// DedupStrategy is how existing issues are searched for: search_api (the
+	// default), issues_list or auto
+	DedupStrategy string `yaml:"dedup_strategy"`
+	// SanitizeLabels fixes configured labels Gitlab would reject instead of
+	// refusing to start
+	SanitizeLabels bool `yaml:"sanitize_labels"`
+	// PruneOrphanedFeeds deletes what Redis holds for feeds no longer in the
+	// configuration at startup, instead of only warning about them
+	PruneOrphanedFeeds bool `yaml:"prune_orphaned_feeds"`
+	// Deployment names this deployment when several share a Redis, each
+	// keeping its own list of the feeds it has configured
+	Deployment string `yaml:"deployment"`
+	// Retention is the default for feeds that don't set their own
+	Retention time.Duration
+	// UnavailableBackoff is how long checks of feeds are paused once their
+	// Gitlab instance looks to be down, see availability
+	UnavailableBackoff time.Duration `yaml:"unavailable_backoff"`
+}
+
+type Feed struct {
+	ID              string
+	FeedURL         string `yaml:"feed_url"`
+	Name            string
+	GitlabProjectID int `yaml:"gitlab_project_id"`
+	Labels          []string
+	AddedSince      time.Time `yaml:"added_since"`
+	Retroactive     bool
+	Username        string
+	Password        string
+	Headers         map[string]string
+	CACertFile      string `yaml:"ca_cert_file"`
+	ClientCertFile  string `yaml:"client_cert_file"`
+	ClientKeyFile   string `yaml:"client_key_file"`
+	// GitlabProject gives the project by path instead of ID, resolved at
+	// startup. With CreateProjectIfMissing it is created in the namespace
+	// GitlabNamespaceID if it doesn't exist.
+	GitlabProject          string `yaml:"gitlab_project"`
+	GitlabNamespaceID      int    `yaml:"gitlab_namespace_id"`
+	CreateProjectIfMissing bool   `yaml:"create_project_if_missing"`
+	// InsecureSkipVerify disables certificate verification, a last resort for
+	// feeds whose CA can't be supplied via ca_cert_file.
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
+	FetchTimeout       time.Duration `yaml:"fetch_timeout"`
+	// AutoDiscover follows the feed advertised by an HTML page when feed_url
+	// points at a site rather than its feed.
+	AutoDiscover bool `yaml:"auto_discover"`
+	// MaxItemsPerRun caps how many new articles are sent to Gitlab per run,
+	// the rest are deferred to later runs. Zero means no limit.
+	MaxItemsPerRun int `yaml:"max_items_per_run"`
+	// MaxAge ignores items older than this, re-evaluated every run. When
+	// AddedSince is also set the later of the two cutoffs wins.
+	MaxAge time.Duration `yaml:"max_age"`
+	// Retention forgets GUIDs synced longer ago than this once they have left
+	// the feed document, see pruneItems. Zero keeps them forever.
+	Retention time.Duration
+	// Items are filtered on their title with these patterns, see filterReason
+	IncludeTitleRegex string `yaml:"include_title_regex"`
+	ExcludeTitleRegex string `yaml:"exclude_title_regex"`
+	// Items are filtered on their categories, compared case-insensitively
+	IncludeCategories  []string `yaml:"include_categories"`
+	ExcludeCategories  []string `yaml:"exclude_categories"`
+	CategoriesAsLabels bool     `yaml:"categories_as_labels"`
+	// CategoryLabelMap renames categories added as labels. Categories it
+	// doesn't list are added as they are unless PassthroughCategories is false.
+	CategoryLabelMap      map[string]string `yaml:"category_label_map"`
+	PassthroughCategories *bool             `yaml:"passthrough_categories"`
+	// Items are filtered on their authors' names or emails, compared
+	// case-insensitively. AuthorlessPolicy is "pass" (default) or "drop".
+	IncludeAuthors   []string `yaml:"include_authors"`
+	ExcludeAuthors   []string `yaml:"exclude_authors"`
+	AuthorlessPolicy string   `yaml:"authorless_policy"`
+	// TrackUpdates watches synced items for changes to their content and
+	// reports them on the original issue, or in a follow-up issue.
+	TrackUpdates bool `yaml:"track_updates"`
+	// SyncUpdates rewrites the issue of a changed item instead of adding a
+	// note, and implies TrackUpdates
+	SyncUpdates bool `yaml:"sync_updates"`
+	// CloseOnPattern closes the issue of an updated item whose title or body
+	// matches it, and implies TrackUpdates
+	CloseOnPattern string `yaml:"close_on_pattern"`
+	// Go templates for the issue title and description, see templateData.
+	// The defaults are the item title and issueDescription's layout.
+	TitleTemplate       string `yaml:"title_template"`
+	DescriptionTemplate string `yaml:"description_template"`
+	// FooterTemplate overrides the global footer_template, and Footer false
+	// leaves the footer out, though the GUID marker stays
+	FooterTemplate string `yaml:"footer_template"`
+	Footer         *bool
+	// GUIDNormalization lists the normalizeGUID modes applied to URL GUIDs
+	GUIDNormalization []string `yaml:"guid_normalization"`
+	// Enabled pauses the feed when set to false, leaving its state in Redis
+	// alone. Feeds are enabled by default.
+	Enabled *bool
+	// MaxBodyLength truncates item bodies longer than this many bytes,
+	// defaulting to defaultMaxBodyLength
+	MaxBodyLength int `yaml:"max_body_length"`
+	// MaxDescriptionLength truncates whole issue descriptions longer than this
+	// many bytes, defaulting to defaultMaxDescriptionLength
+	MaxDescriptionLength int `yaml:"max_description_length"`
+	// Interval overrides the global interval between checks of this feed, and
+	// Schedule replaces it with a cron expression
+	Interval time.Duration
+	Schedule string
+	// FollowRedirects set to false treats redirects as errors. With
+	// PersistRedirects the target of a permanent redirect is fetched directly
+	// from then on.
+	FollowRedirects  *bool `yaml:"follow_redirects"`
+	PersistRedirects bool  `yaml:"persist_redirects"`
+	// IncludeEnclosures lists the item's enclosures and media in the issue,
+	// true unless set otherwise
+	IncludeEnclosures *bool `yaml:"include_enclosures"`
+	// LeadImage puts the item's first image at the top of the issue
+	LeadImage bool `yaml:"lead_image"`
+	// MinItemAge holds back items published or updated more recently than
+	// this, so posts still being edited are synced once they've settled
+	MinItemAge time.Duration `yaml:"min_item_age"`
+	// FollowArchive backfills the feed from its RFC 5005 archive documents on
+	// the first sync, reading at most MaxArchivePages of them
+	FollowArchive   bool `yaml:"follow_archive"`
+	MaxArchivePages int  `yaml:"max_archive_pages"`
+	// Issues are assigned to AssigneeIDs plus the users named in
+	// AssigneeUsernames, resolved at startup
+	AssigneeIDs       []int    `yaml:"assignee_ids"`
+	AssigneeUsernames []string `yaml:"assignee_usernames"`
+	// AuthorAssigneeMap assigns issues to the username given for the item's
+	// author name or email instead, case-insensitively
+	AuthorAssigneeMap map[string]string `yaml:"author_assignee_map"`
+	// Milestone is the ID or title of the project milestone issues are added
+	// to, checked at startup
+	Milestone string
+	// DueIn sets the due date of created issues this long after the item (or
+	// now, unless retroactive), as a duration or a number of days
+	DueIn string `yaml:"due_in"`
+	// Confidential creates issues only visible to project members with at
+	// least Reporter access
+	Confidential bool
+	// Weight is the weight of created issues, left unset when nil
+	Weight *int
+	// IssueType creates incidents or test cases instead of plain issues
+	IssueType string `yaml:"issue_type"`
+	// OnDuplicate is what happens when an item new to Redis already has an
+	// issue: skip (the default) just marks it as synced, comment also adds a
+	// note to the issue
+	OnDuplicate string `yaml:"on_duplicate"`
+	// DedupeByTitle also treats an issue with exactly the same title, created
+	// within DedupeTitleWindow, as the item's issue, for feeds whose GUIDs
+	// change when an item is republished
+	DedupeByTitle     bool          `yaml:"dedupe_by_title"`
+	DedupeTitleWindow time.Duration `yaml:"dedupe_title_window"`
+	// LinkRelated links the issue of an item referring to an item synced
+	// earlier, by its GUID in the link or content, to that item's issue
+	LinkRelated bool `yaml:"link_related"`
+	// ResyncDeleted forgets an item when its issue is deleted, as reported by
+	// the webhook, so it is created again if still in the feed
+	ResyncDeleted bool `yaml:"resync_deleted"`
+	// MetadataFooter appends the feed, GUID and publication time to issue
+	// descriptions in a hidden block parseMetadataFooter can read back
+	MetadataFooter bool `yaml:"metadata_footer"`
+	// Target is what items become: project issues (the default) or, with
+	// epic, epics in the group GitlabGroupID
+	Target        string
+	GitlabGroupID int `yaml:"gitlab_group_id"`
+	// State closed closes issues straight after creating them, to archive a
+	// feed without leaving its issues open
+	State string
+	// UseGraphQL creates issues as work items of WorkItemType, Issue unless
+	// set, with the GraphQL API instead of the REST API
+	UseGraphQL   bool   `yaml:"use_graphql"`
+	WorkItemType string `yaml:"work_item_type"`
+	// Issues are added to the epic with EpicIID in EpicGroup, or to the epic
+	// with the global ID EpicID
+	EpicID    int    `yaml:"epic_id"`
+	EpicIID   int    `yaml:"epic_iid"`
+	EpicGroup string `yaml:"epic_group"`
+	// GitlabBaseURL is the API URL of the Gitlab instance issues are created
+	// in, with a token read from the GitlabTokenEnv environment variable, or
+	// from the file it names with a _FILE suffix, of type GitlabTokenType.
+	// Defaults to GITLAB_API_BASE_URL and GITLAB_API_TOKEN.
+	GitlabBaseURL   string `yaml:"gitlab_base_url"`
+	GitlabTokenEnv  string `yaml:"gitlab_token_env"`
+	GitlabTokenType string `yaml:"gitlab_token_type"`
+	// DryRun logs the issues that would be created instead of creating them,
+	// like the -dry-run flag for just this feed
+	DryRun bool `yaml:"dry_run"`
+	// RawHTML skips the HTML to Markdown conversion of item bodies, for feeds
+	// that already publish Markdown
+	RawHTML bool `yaml:"raw_html"`
+	// TrackingParams overrides the global tracking_params for this feed
+	TrackingParams []string `yaml:"tracking_params"`
+
+	httpClient   *http.Client
+	baseURL      string
+	cronSchedule cron.Schedule
+	includeTitle *regexp.Regexp
+	excludeTitle *regexp.Regexp
+	closePattern *regexp.Regexp
+	assignees    []int
+	milestone    *milestoneRef
+	dueIn        time.Duration
+	epicID       int
+
+	authorAssignees map[string]int
+
+	titleTemplate       *template.Template
+	descriptionTemplate *template.Template
+	footerTemplate      *template.Template
+}
+
+func readConfig(path string) *Config {
+	config := &Config{}
+
+	data, err := os.ReadFile(path) // Use os.ReadFile instead of ioutil.ReadFile
+	if err != nil {
+		log.Fatalf("Error reading config file %s: %v", path, err) // Log the error properly
+	}
+
+	var document yaml.Node
+	if err = yaml.Unmarshal(data, &document); err != nil {
+		log.Printf("Unable to parse config YAML \n %s \n", err)
+		panic(err)
+	}
+	if err = expandEnvRefsInNode(&document); err != nil {
+		log.Fatalf("Unable to interpolate environment variables in config file %s: %v", path, err)
+	}
+	if err = document.Decode(config); err != nil {
+		log.Printf("Unable to parse config YAML \n %s \n", err)
+		panic(err)
+	}
+
+	if config.OPMLFile != "" {
+		config.addOPMLFeeds(filepath.Dir(path))
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = int(defaultInterval / time.Second)
+		log.Printf("Invalid interval in config, using default: %v", defaultInterval)
+	}
+	if config.FetchTimeout <= 0 {
+		config.FetchTimeout = defaultFetchTimeout
+	}
+	if config.TrackingParams == nil {
+		config.TrackingParams = defaultTrackingParams
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultConcurrency
+	}
+	if config.UnavailableBackoff <= 0 {
+		config.UnavailableBackoff = defaultUnavailableBackoff
+	}
+
+	switch config.DedupStrategy {
+	case "":
+		config.DedupStrategy = searchAPIStrategy
+	case searchAPIStrategy, issuesListStrategy, autoStrategy:
+	default:
+		log.Fatalf("Invalid dedup_strategy %q, expected search_api, issues_list or auto", config.DedupStrategy)
+	}
+
+	for name, definition := range config.LabelDefinitions {
+		if definition.Color == "" {
+			log.Fatalf("Label %s in label_definitions has no color", name)
+		}
+	}
+
+	for i := range config.Feeds {
+		feed := &config.Feeds[i]
+		if feed.FetchTimeout <= 0 {
+			feed.FetchTimeout = config.FetchTimeout
+		}
+		if feed.TrackingParams == nil {
+			feed.TrackingParams = config.TrackingParams
+		}
+		if feed.FooterTemplate == "" {
+			feed.FooterTemplate = config.FooterTemplate
+		}
+		if feed.Retention == 0 {
+			feed.Retention = config.Retention
+		}
+		if feed.Retention > 0 && feed.MaxAge > 0 && feed.Retention <= feed.MaxAge {
+			log.Printf("WARNING: retention of feed %s is no longer than its max_age, items it forgets would be synced again if they reappear in the feed", feed.Name)
+		}
+		if feed.MaxBodyLength <= 0 {
+			feed.MaxBodyLength = defaultMaxBodyLength
+		}
+		if feed.MaxDescriptionLength <= 0 {
+			feed.MaxDescriptionLength = defaultMaxDescriptionLength
+		}
+		if feed.DedupeTitleWindow <= 0 {
+			feed.DedupeTitleWindow = defaultDedupeTitleWindow
+		}
+		if feed.MaxArchivePages <= 0 {
+			feed.MaxArchivePages = defaultMaxArchivePages
+		}
+		if feed.httpClient, err = feed.newHTTPClient(); err != nil {
+			log.Fatalf("Unable to configure HTTP client for feed %s: %v", feed.Name, err)
+		}
+		if err = feed.compileFilters(); err != nil {
+			log.Fatalf("Invalid filter for feed %s: %v", feed.Name, err)
+		}
+		if err = feed.checkLabels(config.SanitizeLabels); err != nil {
+			log.Fatalf("Invalid labels for feed %s, fix them or set sanitize_labels: %v", feed.Name, err)
+		}
+		if err = feed.compileTemplates(); err != nil {
+			log.Fatalf("Invalid template for feed %s: %v", feed.Name, err)
+		}
+		if err = feed.validateGUIDNormalization(); err != nil {
+			log.Fatalf("Invalid config for feed %s: %v", feed.Name, err)
+		}
+		if feed.dueIn, err = parseDueIn(feed.DueIn); err != nil {
+			log.Fatalf("Invalid due_in for feed %s: %v", feed.Name, err)
+		}
+		switch feed.IssueType {
+		case "", "issue", "incident", "test_case":
+		default:
+			log.Fatalf("Invalid issue_type %q for feed %s, expected issue, incident or test_case", feed.IssueType, feed.Name)
+		}
+		switch feed.GitlabTokenType {
+		case "", "pat", "job", "oauth":
+		default:
+			log.Fatalf("Invalid gitlab_token_type %q for feed %s, expected pat, job or oauth", feed.GitlabTokenType, feed.Name)
+		}
+		switch feed.OnDuplicate {
+		case "", "skip", "comment":
+		default:
+			log.Fatalf("Invalid on_duplicate %q for feed %s, expected skip or comment", feed.OnDuplicate, feed.Name)
+		}
+		switch feed.State {
+		case "", "opened", "closed":
+		default:
+			log.Fatalf("Invalid state %q for feed %s, expected opened or closed", feed.State, feed.Name)
+		}
+		if feed.GitlabProject != "" && feed.GitlabProjectID != 0 {
+			log.Fatalf("Invalid config for feed %s: gitlab_project and gitlab_project_id can't both be set", feed.Name)
+		}
+		if feed.CreateProjectIfMissing && (feed.GitlabProject == "" || feed.GitlabNamespaceID == 0) {
+			log.Fatalf("Invalid config for feed %s: create_project_if_missing needs gitlab_project and gitlab_namespace_id", feed.Name)
+		}
+		if feed.ResyncDeleted && config.WebhookSecret == "" {
+			log.Printf("WARNING: feed %s sets resync_deleted without webhook_secret, deleted issues won't be reported", feed.Name)
+		}
+		if feed.UseGraphQL && (feed.IssueType != "" || feed.EpicID != 0 || feed.EpicIID != 0) {
+			log.Fatalf("Invalid config for feed %s: use_graphql takes work_item_type instead of issue_type, and can't add issues to epics", feed.Name)
+		}
+		if err = feed.validateTarget(); err != nil {
+			log.Fatalf("Invalid config for feed %s: %v", feed.Name, err)
+		}
+		if feed.Schedule != "" {
+			if feed.cronSchedule, err = cron.ParseStandard(feed.Schedule); err != nil {
+				log.Fatalf("Invalid schedule for feed %s: %v", feed.Name, err)
+			}
+		}
+	}
+
+	if len(config.Feeds) > 0 && len(config.enabledFeeds()) == 0 {
+		log.Printf("WARNING: every feed in %s is disabled, nothing will be synced", path)
+	}
+
+	return config
+}
+
+// parseDueIn reads due_in as either a number of days or a duration.
+func parseDueIn(dueIn string) (time.Duration, error) {
+	if dueIn == "" {
+		return 0, nil
+	}
+	if days, err := strconv.Atoi(dueIn); err == nil {
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(dueIn)
+}
+
+// interval is the time between runs.
+func (config *Config) interval() time.Duration {
+	return time.Duration(config.Interval) * time.Second
+}
+
+// isEnabled reports whether the feed should be checked, true unless the
+// config says otherwise.
+func (feed Feed) isEnabled() bool {
+	return feed.Enabled == nil || *feed.Enabled
+}
+
+// passesThroughCategories reports whether categories missing from
+// category_label_map are still added as labels, true unless the config says
+// otherwise.
+func (feed Feed) passesThroughCategories() bool {
+	return feed.PassthroughCategories == nil || *feed.PassthroughCategories
+}
+
+// showsFooter reports whether issue descriptions end with a footer, true
+// unless the config says otherwise.
+func (feed Feed) showsFooter() bool {
+	return feed.Footer == nil || *feed.Footer
+}
+
+// tracksUpdates reports whether synced items are watched for changes.
+func (feed Feed) tracksUpdates() bool {
+	return feed.TrackUpdates || feed.SyncUpdates || feed.CloseOnPattern != ""
+}
+
+// followsRedirects reports whether redirects are followed when fetching the
+// feed, true unless the config says otherwise.
+func (feed Feed) followsRedirects() bool {
+	return feed.FollowRedirects == nil || *feed.FollowRedirects
+}
+
+// includesEnclosures reports whether attachments are listed in issues, true
+// unless the config says otherwise.
+func (feed Feed) includesEnclosures() bool {
+	return feed.IncludeEnclosures == nil || *feed.IncludeEnclosures
+}
+
+func (config *Config) enabledFeeds() []Feed {
+	var feeds []Feed
+	for _, feed := range config.Feeds {
+		if feed.isEnabled() {
+			feeds = append(feeds, feed)
+		}
+	}
+	return feeds
+}
+
+// addOPMLFeeds appends the subscriptions from the configured OPML file to the
+// feed list. Feeds already configured explicitly are left alone.
+func (config *Config) addOPMLFeeds(confDir string) {
+	opmlPath := config.OPMLFile
+	if !filepath.IsAbs(opmlPath) {
+		opmlPath = filepath.Join(confDir, opmlPath)
+	}
+	feeds, err := readOPML(opmlPath, config.OPMLProjectID, config.OPMLLabels)
+	if err != nil {
+		log.Fatalf("Error reading OPML file %s: %v", opmlPath, err)
+	}
+
+	configured := make(map[string]bool)
+	for _, feed := range config.Feeds {
+		configured[feed.FeedURL] = true
+	}
+	added := 0
+	for _, feed := range feeds {
+		if configured[feed.FeedURL] {
+			continue
+		}
+		configured[feed.FeedURL] = true
+		config.Feeds = append(config.Feeds, feed)
+		added++
+	}
+	log.Printf("Imported %d feeds from %s", added, opmlPath)
+}
+
+// envRefPattern matches ${NAME} references, and $$ escapes for a literal $.
+var envRefPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvRefs replaces every ${NAME} in value with the contents of the NAME
+// environment variable, so secrets don't have to live in config.yaml. $$
+// produces a literal $.
+func expandEnvRefs(value string) (string, error) {
+	var missing []string
+	expanded := envRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		name := envRefPattern.FindStringSubmatch(ref)[1]
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return resolved
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable(s) not set: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// expandEnvRefsInNode expands environment variable references in every scalar
+// value of a parsed YAML document. Mapping keys are left alone.
+func expandEnvRefsInNode(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := expandEnvRefsInNode(child); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := expandEnvRefsInNode(node.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		expanded, err := expandEnvRefs(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = expanded
+		if node.Style == 0 {
+			// Let plain scalars resolve their type from the expanded value, so
+			// a variable can provide a number or a bool
+			node.Tag = ""
+		}
+	}
+	return nil
+}
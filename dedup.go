@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// Dedup strategies, how hasExistingGitlabIssue searches a project: with the
+// Search API, or by listing issues with a search of their descriptions, which
+// works on instances where the Search API is slow or disabled.
+const (
+	searchAPIStrategy  = "search_api"
+	issuesListStrategy = "issues_list"
+	autoStrategy       = "auto"
+)
+
+// dedupStrategies is the dedup strategy of each Gitlab instance, by API base
+// URL, chosen at startup.
+var dedupStrategies = make(map[string]string)
+
+// chooseDedupStrategies sets the dedup strategy of each instance from
+// dedup_strategy. With auto, the Search API is tried once and issues_list used
+// if it answers 403 or 404.
+func (config *Config) chooseDedupStrategies(gitlabs gitlabInstances) {
+	for baseURL, gitlabClient := range gitlabs {
+		strategy := config.DedupStrategy
+		if strategy == autoStrategy {
+			strategy = config.probeSearchAPI(baseURL, gitlabClient)
+		}
+		dedupStrategies[baseURL] = strategy
+		log.Printf("Checking for existing issues in %s with the %s dedup strategy", baseURL, strategy)
+	}
+}
+
+// probeSearchAPI tries a search in a project of the instance, returning the
+// strategy to use.
+func (config *Config) probeSearchAPI(baseURL string, gitlabClient *gitlab.Client) string {
+	for _, feed := range config.Feeds {
+		if feed.GitlabBaseURL != baseURL || feed.targetsEpics() || !feed.isEnabled() {
+			continue
+		}
+		opt := &gitlab.SearchOptions{ListOptions: gitlab.ListOptions{PerPage: 1}}
+		_, resp, err := gitlabClient.Search.IssuesByProject(feed.GitlabProjectID, "gitlab-rss-sync", opt, gitlab.WithContext(context.Background()))
+		if err != nil && resp != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound) {
+			log.Printf("The Search API of %s answered %s, falling back to listing issues: %v", baseURL, resp.Status, err)
+			return issuesListStrategy
+		}
+		if err != nil {
+			log.Printf("WARNING: unable to try the Search API of %s, using it anyway: %v", baseURL, err)
+		}
+		return searchAPIStrategy
+	}
+	return searchAPIStrategy
+}
+
+// searchIssues returns a page of the project's issues matching query with the
+// given dedup strategy.
+func searchIssues(gitlabClient *gitlab.Client, projectID int, query, strategy string, page gitlab.ListOptions) ([]*gitlab.Issue, *gitlab.Response, error) {
+	if strategy == issuesListStrategy {
+		opt := &gitlab.ListProjectIssuesOptions{
+			ListOptions: page,
+			Search:      gitlab.String(query),
+			In:          gitlab.String("description"),
+		}
+		return gitlabClient.Issues.ListProjectIssues(projectID, opt, gitlab.WithContext(context.Background()))
+	}
+	opt := &gitlab.SearchOptions{ListOptions: page}
+	return gitlabClient.Search.IssuesByProject(projectID, query, opt, gitlab.WithContext(context.Background()))
+}
+
+// maxIndexPages bounds how many pages of the project's issues indexIssues
+// lists, newest first.
+const maxIndexPages = 10
+
+// guidMarkerPattern reads the GUID back out of the marker guidMarker writes.
+var guidMarkerPattern = regexp.MustCompile(`^<!-- guid: (.*) -->$`)
+
+// issueIndex maps the GUIDs of new items to the issues already created for
+// them, from a single listing of the project's issues, so a feed's new items
+// don't each need a search.
+type issueIndex struct {
+	issues map[string]*gitlab.Issue
+	// complete is set when every issue of the project was listed, so a GUID
+	// missing from the index has no issue
+	complete bool
+}
+
+// indexIssues lists the project's issues, newest first, until every new item
+// has been matched, the project runs out of issues or maxIndexPages is reached.
+// It returns the index and the number of requests made.
+func (feed Feed) indexIssues(gitlabClient *gitlab.Client, items []*gofeed.Item) (*issueIndex, int, error) {
+	pending := make(map[string]bool, len(items))
+	markers := make(map[string]string, len(items))
+	for _, item := range items {
+		pending[item.GUID] = true
+		markers[markerFor(feed.ID, item.GUID)] = item.GUID
+	}
+	index := &issueIndex{issues: make(map[string]*gitlab.Issue)}
+	opt := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{Page: 1, PerPage: 100},
+		OrderBy:     gitlab.String("created_at"),
+		Sort:        gitlab.String("desc"),
+	}
+	requests := 0
+	for requests < maxIndexPages && len(index.issues) < len(pending) {
+		issues, resp, err := gitlabClient.Issues.ListProjectIssues(feed.GitlabProjectID, opt, gitlab.WithContext(context.Background()))
+		requests++
+		if err != nil {
+			return nil, requests, err
+		}
+		for _, issue := range issues {
+			for _, guid := range descriptionGUIDs(issue.Description, pending, markers) {
+				// Newest first, so this leaves the oldest issue for the GUID
+				index.issues[guid] = issue
+			}
+		}
+		if resp.NextPage == 0 {
+			index.complete = true
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return index, requests, nil
+}
+
+// descriptionGUIDs returns the GUIDs among pending an issue description
+// carries, by their markerFor markers in markers when it has one, as
+// descriptionMatches does, otherwise in any of the forms descriptionHasGUID
+// accepts.
+func descriptionGUIDs(description string, pending map[string]bool, markers map[string]string) []string {
+	var guids []string
+	if strings.Contains(description, syncIDPrefix) {
+		for _, line := range strings.Split(description, "\n") {
+			if guid, ok := markers[strings.TrimSpace(line)]; ok {
+				guids = append(guids, guid)
+			}
+		}
+		return guids
+	}
+	if metadata, ok := parseMetadataFooter(description); ok && pending[metadata.GUID] {
+		guids = append(guids, metadata.GUID)
+	}
+	for _, segment := range descriptionSegments(description) {
+		if match := guidMarkerPattern.FindStringSubmatch(segment); match != nil {
+			segment = match[1]
+		}
+		if pending[segment] {
+			guids = append(guids, segment)
+		}
+	}
+	return guids
+}
+
+// lookup returns the issue indexed for the GUID, and whether the index could
+// tell: a GUID it didn't find may still have an issue older than those listed.
+func (index *issueIndex) lookup(guid string) (*gitlab.Issue, bool) {
+	if index == nil {
+		return nil, false
+	}
+	if issue, ok := index.issues[guid]; ok {
+		log.Printf("Found existing issue for %s in project (%s). Marking as syncronised.\n", guid, issue.WebURL)
+		return issue, true
+	}
+	return nil, index.complete
+}
+
+// defaultDedupeTitleWindow is how far back dedupe_by_title looks for an issue
+// with the same title when dedupe_title_window isn't set.
+const defaultDedupeTitleWindow = 30 * 24 * time.Hour
+
+// titleWindowStart is the creation date after which findIssueByTitle looks for
+// issues. Retroactive feeds date their issues by their items, so the window
+// can't be measured from now: it starts at the feed's cutoff instead, or not
+// at all without one.
+func (feed Feed) titleWindowStart() time.Time {
+	if feed.Retroactive {
+		return feed.cutoff()
+	}
+	return time.Now().Add(-feed.DedupeTitleWindow)
+}
+
+// findIssueByTitle looks for an issue with exactly the title, created within
+// the feed's dedupe_title_window, for feeds whose GUIDs change when an item is
+// republished. It returns the oldest one found, or nil.
+func (feed Feed) findIssueByTitle(gitlabClient *gitlab.Client, title string) (*gitlab.Issue, error) {
+	opt := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{Page: 1, PerPage: 100},
+		Search:      gitlab.String(title),
+		In:          gitlab.String("title"),
+	}
+	if start := feed.titleWindowStart(); !start.IsZero() {
+		opt.CreatedAfter = gitlab.Ptr(start)
+	}
+	var existing *gitlab.Issue
+	for page := 0; page < maxSearchPages; page++ {
+		candidates, resp, err := gitlabClient.Issues.ListProjectIssues(feed.GitlabProjectID, opt, gitlab.WithContext(context.Background()))
+		if err != nil {
+			return nil, err
+		}
+		for _, candidate := range candidates {
+			// The search matches words, only the exact title counts
+			if candidate.Title == title && (existing == nil || candidate.IID < existing.IID) {
+				existing = candidate
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return existing, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDescriptionHasGUID(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		guid        string
+		want        bool
+	}{
+		{"marker", "Body\n\nSource: https://example.com/a\n\n<!-- guid: https://example.com/a -->", "https://example.com/a", true},
+		{"bare line", "Body\nhttps://example.com/a\n  https://example.com/a  ", "https://example.com/a", true},
+		{"legacy br format", "Body line\nmore body<br>https://example.com/a<br>urn:item:1", "urn:item:1", true},
+		{"legacy single line", "Body<br>https://example.com/a<br>urn:item:1", "urn:item:1", true},
+		{"guid prefix of another", "Body<br>https://example.com/a<br>urn:item:10", "urn:item:1", false},
+		{"guid prefix of another marker", "Body\n<!-- guid: urn:item:10 -->", "urn:item:1", false},
+		{"guid inside text", "See urn:item:1 for details", "urn:item:1", false},
+		{"no guid", "Body only", "urn:item:1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := descriptionHasGUID(test.description, test.guid); got != test.want {
+				t.Errorf("descriptionHasGUID(%q, %q) = %v, want %v", test.description, test.guid, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDescriptionGUIDs(t *testing.T) {
+	pending := map[string]bool{"urn:item:1": true, "urn:item:2": true}
+	tests := []struct {
+		name        string
+		description string
+		want        []string
+	}{
+		{"marker", "Body\n\n<!-- guid: urn:item:2 -->", []string{"urn:item:2"}},
+		{"legacy br format", "Body<br>https://example.com/a<br>urn:item:1", []string{"urn:item:1"}},
+		{"guid prefix of another", "Body<br>https://example.com/a<br>urn:item:10", nil},
+		{"not pending", "Body\n\n<!-- guid: urn:item:3 -->", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := descriptionGUIDs(test.description, pending, nil); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("descriptionGUIDs(%q) = %v, want %v", test.description, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHasExistingGitlabIssuePaginates(t *testing.T) {
+	var pages []string
+	client := newTestGitlab(t, func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+		switch page {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id": 1, "iid": 1, "description": "<!-- guid: urn:item:12345 -->"}]`)
+		case "2":
+			w.Header().Set("X-Next-Page", "3")
+			fmt.Fprint(w, `[{"id": 3, "iid": 3, "description": "Body\n\n<!-- guid: urn:item:1234 -->"},
+				{"id": 2, "iid": 2, "description": "Body\n\n<!-- guid: urn:item:1234 -->"}]`)
+		default:
+			if r.URL.Query().Get("search") == "urn:item:1234" {
+				t.Errorf("requested page %s after finding a match", page)
+			}
+			fmt.Fprint(w, `[]`)
+		}
+	})
+
+	issue, requests, err := hasExistingGitlabIssue("feed", "urn:item:1234", 1, client, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issue == nil || issue.IID != 2 {
+		t.Errorf("found %+v, want the oldest exact match", issue)
+	}
+	if requests != 2 || !reflect.DeepEqual(pages, []string{"1", "2"}) {
+		t.Errorf("made %d requests for pages %v", requests, pages)
+	}
+
+	issue, requests, err = hasExistingGitlabIssue("feed", "urn:item:123", 1, client, "")
+	if err != nil || issue != nil || requests != 3 {
+		t.Errorf("fuzzy matches only returned %+v after %d requests, %v", issue, requests, err)
+	}
+}
+
+func TestFindIssueByTitleWindow(t *testing.T) {
+	addedSince := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		feed Feed
+		// want is the created_after asked for, "" for none, or "recent" for
+		// about dedupe_title_window ago
+		want string
+	}{
+		{"window", Feed{DedupeTitleWindow: time.Hour}, "recent"},
+		{"retroactive", Feed{Retroactive: true, DedupeTitleWindow: time.Hour, AddedSince: addedSince}, "2020-01-01T00:00:00Z"},
+		{"retroactive without cutoff", Feed{Retroactive: true, DedupeTitleWindow: time.Hour}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var createdAfter string
+			client := newTestGitlab(t, func(w http.ResponseWriter, r *http.Request) {
+				createdAfter = r.URL.Query().Get("created_after")
+				fmt.Fprint(w, `[{"id": 1, "iid": 1, "title": "Old advisory", "created_at": "2021-06-01T00:00:00Z"}]`)
+			})
+			test.feed.GitlabProjectID = 1
+
+			issue, err := test.feed.findIssueByTitle(client, "Old advisory")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if issue == nil || issue.IID != 1 {
+				t.Errorf("findIssueByTitle() = %v, want issue 1", issue)
+			}
+			if test.want == "recent" {
+				if after, err := time.Parse(time.RFC3339, createdAfter); err != nil || time.Since(after) > 2*time.Hour {
+					t.Errorf("created_after = %q, want about an hour ago", createdAfter)
+				}
+			} else if createdAfter != test.want {
+				t.Errorf("created_after = %q, want %q", createdAfter, test.want)
+			}
+		})
+	}
+}
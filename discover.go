@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// feedMediaTypes are the <link type="..."> values that advertise a feed.
+var feedMediaTypes = []string{"application/rss+xml", "application/atom+xml"}
+
+// discoverFeedURL scans an HTML page for <link rel="alternate"> tags pointing at
+// an RSS or Atom feed and returns the first one, resolved against pageURL. An
+// empty string is returned when the page doesn't advertise a feed.
+func discoverFeedURL(page []byte, pageURL *url.URL) string {
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.DataAtom != atom.Link {
+				continue
+			}
+
+			var rel, mediaType, href string
+			for _, attr := range token.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "rel":
+					rel = attr.Val
+				case "type":
+					mediaType = attr.Val
+				case "href":
+					href = attr.Val
+				}
+			}
+			if href == "" || !hasRel(rel, "alternate") || !isFeedMediaType(mediaType) {
+				continue
+			}
+
+			ref, err := url.Parse(href)
+			if err != nil {
+				continue
+			}
+			return pageURL.ResolveReference(ref).String()
+		}
+	}
+}
+
+// hasRel reports whether the space separated rel attribute contains want.
+func hasRel(rel, want string) bool {
+	for _, value := range strings.Fields(rel) {
+		if strings.EqualFold(value, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFeedMediaType(mediaType string) bool {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, candidate := range feedMediaTypes {
+		if mediaType == candidate {
+			return true
+		}
+	}
+	return false
+}
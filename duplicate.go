@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// noteDuplicate adds a note to an existing issue for an item seen again in the
+// feed, so the issue shows up in activity feeds.
+func (feed Feed) noteDuplicate(gitlabClient *gitlab.Client, issue *gitlab.Issue) {
+	noteOptions := &gitlab.CreateIssueNoteOptions{
+		Body: gitlab.String(fmt.Sprintf("Seen again in feed %s on %s.", feed.Name, time.Now().UTC().Format(time.DateOnly))),
+	}
+	if _, _, err := gitlabClient.Notes.CreateIssueNote(issue.ProjectID, issue.IID, noteOptions); err != nil {
+		log.Printf("Unable to add note to existing issue #%d in project %d for feed %s: %v", issue.IID, issue.ProjectID, feed.Name, err)
+		return
+	}
+	log.Printf("Added note to existing issue %s for feed %s", issue.WebURL, feed.Name)
+	duplicateNotesCounter.WithLabelValues(feed.Name).Inc()
+}
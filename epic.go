@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// resolveEpics checks the epic of each feed configured with epic_group and
+// epic_iid exists and is readable, and looks up the ID issues are linked with.
+// A bare epic_id can't be looked up through the API, so is used as is.
+func (config *Config) resolveEpics(gitlabs gitlabInstances) error {
+	for i := range config.Feeds {
+		feed := &config.Feeds[i]
+		feed.epicID = feed.EpicID
+		if feed.EpicIID == 0 {
+			continue
+		}
+		if feed.EpicGroup == "" {
+			return fmt.Errorf("feed %s sets epic_iid without epic_group", feed.Name)
+		}
+		epic, _, err := gitlabs.forFeed(*feed).Epics.GetEpic(feed.EpicGroup, feed.EpicIID, gitlab.WithContext(context.Background()))
+		if err != nil {
+			return fmt.Errorf("looking up epic &%d in %s for feed %s: %w", feed.EpicIID, feed.EpicGroup, feed.Name, err)
+		}
+		log.Printf("Issues from %s are added to epic '%s'", feed.Name, epic.Title)
+		feed.epicID = epic.ID
+	}
+	return nil
+}
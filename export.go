@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// importBatchSize is how many exported items are written to Redis per
+// transaction on import.
+const importBatchSize = 500
+
+// exportedItem is a line of an export: a synced GUID, with when it was synced
+// and the issue reference and item record kept for it, if any, as they are
+// stored.
+type exportedItem struct {
+	FeedID   string          `json:"feed_id"`
+	GUID     string          `json:"guid"`
+	SyncedAt *time.Time      `json:"synced_at,omitempty"`
+	Issue    string          `json:"issue,omitempty"`
+	Item     json.RawMessage `json:"item,omitempty"`
+}
+
+// exportItems writes every GUID recorded for the configured feeds to w as
+// line-delimited JSON.
+func (config *Config) exportItems(ctx context.Context, redisClient *redis.Client, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, feed := range config.Feeds {
+		exported := 0
+		var cursor uint64
+		for {
+			guids, next, err := syncedItems(ctx, redisClient, feed.ID, cursor, maxItemsPageSize)
+			if err != nil {
+				return fmt.Errorf("listing items of %s: %w", feed.Name, err)
+			}
+			if len(guids) > 0 {
+				issues := redisClient.HMGet(ctx, issuesKey(feed.ID), guids...)
+				records := redisClient.HMGet(ctx, itemsKey(feed.ID), guids...)
+				if err := issues.Err(); err != nil {
+					return fmt.Errorf("reading issue references of %s: %w", feed.Name, err)
+				}
+				if err := records.Err(); err != nil {
+					return fmt.Errorf("reading item records of %s: %w", feed.Name, err)
+				}
+				syncedAt, err := syncedTimes(ctx, redisClient, feed.ID, guids)
+				if err != nil {
+					return fmt.Errorf("reading when items of %s were synced: %w", feed.Name, err)
+				}
+				for i, guid := range guids {
+					line := exportedItem{FeedID: feed.ID, GUID: guid}
+					if !syncedAt[i].IsZero() {
+						line.SyncedAt = &syncedAt[i]
+					}
+					if issue, ok := issues.Val()[i].(string); ok {
+						line.Issue = issue
+					}
+					if record, ok := records.Val()[i].(string); ok && json.Valid([]byte(record)) {
+						line.Item = json.RawMessage(record)
+					}
+					if err := encoder.Encode(line); err != nil {
+						return err
+					}
+				}
+				exported += len(guids)
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+		log.Printf("Exported %d items of %s", exported, feed.Name)
+	}
+	return nil
+}
+
+// importItems adds the GUIDs of an export read from r, importBatchSize at a
+// time in a transaction each. Issue references and item records already in
+// Redis are kept, so importing the same export again changes nothing.
+func (config *Config) importItems(ctx context.Context, redisClient *redis.Client, r io.Reader) error {
+	inserted, skipped := make(map[string]int), make(map[string]int)
+	var feedIDs []string
+	var batch []exportedItem
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		added := make([]*redis.IntCmd, len(batch))
+		_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, line := range batch {
+				added[i] = pipe.SAdd(ctx, line.FeedID, line.GUID)
+				pipe.SAdd(ctx, config.knownFeedsKey(), line.FeedID)
+				if line.SyncedAt != nil {
+					pipe.HSetNX(ctx, syncedAtKey(line.FeedID), line.GUID, line.SyncedAt.Unix())
+				}
+				if line.Issue != "" {
+					pipe.HSetNX(ctx, issuesKey(line.FeedID), line.GUID, line.Issue)
+				}
+				if len(line.Item) > 0 {
+					pipe.HSetNX(ctx, itemsKey(line.FeedID), line.GUID, string(line.Item))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i, line := range batch {
+			if inserted[line.FeedID]+skipped[line.FeedID] == 0 {
+				feedIDs = append(feedIDs, line.FeedID)
+			}
+			if added[i].Val() > 0 {
+				inserted[line.FeedID]++
+			} else {
+				skipped[line.FeedID]++
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line exportedItem
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if line.FeedID == "" || line.GUID == "" {
+			return fmt.Errorf("line %d: feed_id and guid are required", lineNumber)
+		}
+		if batch = append(batch, line); len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	for _, feedID := range feedIDs {
+		log.Printf("Imported %d items of feed %s, %d were already synced", inserted[feedID], feedID, skipped[feedID])
+	}
+	return nil
+}
+
+// exportToFile exports to the file given to -export, or stdout for "-".
+func (config *Config) exportToFile(redisClient *redis.Client, path string) error {
+	if path == "-" {
+		return config.exportItems(context.Background(), redisClient, os.Stdout)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	if err := config.exportItems(context.Background(), redisClient, writer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// importFromFile imports the file given to -import, or stdin for "-".
+func (config *Config) importFromFile(redisClient *redis.Client, path string) error {
+	if path == "-" {
+		return config.importItems(context.Background(), redisClient, os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return config.importItems(context.Background(), redisClient, file)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	server, client := newTestRedis(t)
+	ctx := context.Background()
+	feed := Feed{ID: "feed", Name: "feed", GitlabProjectID: 1}
+	config := &Config{Feeds: []Feed{feed}}
+	if err := feed.markSynced(client, "urn:item:1", "urn:item:2"); err != nil {
+		t.Fatal(err)
+	}
+	feed.rememberIssue(client, "urn:item:1", &gitlab.Issue{IID: 7})
+	feed.rememberItem(client, &gofeed.Item{Title: "First", GUID: "urn:item:1"}, &gitlab.Issue{IID: 7})
+	syncedAt := server.HGet(syncedAtKey(feed.ID), "urn:item:1")
+
+	var export bytes.Buffer
+	if err := config.exportItems(ctx, client, &export); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(export.String(), "\n"); lines != 2 {
+		t.Fatalf("exported %d lines, want 2:\n%s", lines, export.String())
+	}
+
+	server.FlushAll()
+	for i := 0; i < 2; i++ {
+		// Importing the same export twice changes nothing the second time
+		if err := config.importItems(ctx, client, bytes.NewReader(export.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, guid := range []string{"urn:item:1", "urn:item:2"} {
+		if found, _ := client.SIsMember(ctx, feed.ID, guid).Result(); !found {
+			t.Errorf("%s isn't synced after the import", guid)
+		}
+	}
+	if count, _ := client.SCard(ctx, feed.ID).Result(); count != 2 {
+		t.Errorf("%d GUIDs after importing twice, want 2", count)
+	}
+	if ref, found, err := getIssueRef(ctx, client, feed.ID, "urn:item:1"); err != nil || !found || ref.IID != 7 {
+		t.Errorf("issue reference after the import = %+v, %v, %v", ref, found, err)
+	}
+	if record, found, err := getItem(ctx, client, feed.ID, "urn:item:1"); err != nil || !found || record.Title != "First" {
+		t.Errorf("item record after the import = %+v, %v, %v", record, found, err)
+	}
+	if got := server.HGet(syncedAtKey(feed.ID), "urn:item:1"); got != syncedAt {
+		t.Errorf("synced at %q after the import, want %q", got, syncedAt)
+	}
+	if known, _ := client.SIsMember(ctx, config.knownFeedsKey(), feed.ID).Result(); !known {
+		t.Error("imported feed isn't in the registry")
+	}
+}
+
+func TestImportRejectsInvalidLines(t *testing.T) {
+	_, client := newTestRedis(t)
+	for _, input := range []string{"{", `{"feed_id": "feed"}`} {
+		if err := (&Config{}).importItems(context.Background(), client, strings.NewReader(input)); err == nil {
+			t.Errorf("import of %q succeeded", input)
+		}
+	}
+}
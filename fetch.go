@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/mmcdole/gofeed"
+)
+
+// errNotModified is returned by fetch when the server answered a conditional
+// request with 304 Not Modified, so there is nothing new to parse.
+var errNotModified = errors.New("feed not modified since last fetch")
+
+// fetchStateKey is the Redis hash holding the HTTP validators (ETag and
+// Last-Modified), or the file mtime for local feeds, from the last successful
+// fetch of a feed.
+func fetchStateKey(feedID string) string {
+	return feedID + ":fetch_state"
+}
+
+// fetchValidators are the fields of the fetch state a feed's next fetch is
+// made conditional with: the ETag and Last-Modified of an HTTP response, or the
+// mtime of a local file.
+type fetchValidators map[string]string
+
+// saveValidators stores the validators of the fetch a check has finished with.
+// Until then the previous ones are kept, so a check that didn't get through
+// every item, crashing or otherwise, doesn't leave them behind a 304.
+func (feed Feed) saveValidators(redisClient *redis.Client, validators fetchValidators) {
+	if len(validators) == 0 {
+		return
+	}
+	if err := redisClient.HSet(context.Background(), fetchStateKey(feed.ID), map[string]string(validators)).Err(); err != nil {
+		log.Printf("Unable to persist fetch state for feed %s in Redis: %v", feed.Name, err)
+	}
+}
+
+// forgetValidators drops the validators from the last fetch of the feed, so
+// its next fetch isn't answered with a 304 and the items left unmarked, while
+// Gitlab was unavailable or otherwise, are looked at again.
+func (feed Feed) forgetValidators(redisClient *redis.Client) {
+	err := redisClient.HDel(context.Background(), fetchStateKey(feed.ID), "etag", "last_modified", "mtime").Err()
+	if err != nil {
+		log.Printf("Unable to reset fetch state for feed %s in Redis: %v", feed.Name, err)
+	}
+}
+
+// redactURL strips any credentials embedded in a feed URL so it is safe to log.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<unparseable URL>"
+	}
+	u.User = nil
+	return u.String()
+}
+
+// newHTTPClient builds the client used to fetch the feed, applying the feed's
+// TLS and redirect settings on top of the default transport.
+func (feed Feed) newHTTPClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: feed.InsecureSkipVerify}
+	if feed.InsecureSkipVerify {
+		log.Printf("WARNING: TLS certificate verification is disabled for feed %s", feed.Name)
+	}
+
+	if feed.CACertFile != "" {
+		pem, err := os.ReadFile(feed.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", feed.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if feed.ClientCertFile != "" || feed.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(feed.ClientCertFile, feed.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{Transport: transport}
+	if !feed.followsRedirects() {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client, nil
+}
+
+// localFeedPath returns the filesystem path for file:// URLs and plain paths, or
+// an empty string when the feed should be fetched over HTTP.
+func localFeedPath(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "file":
+		return u.Path
+	case "":
+		return feedURL
+	}
+	return ""
+}
+
+// fetchFile reads and parses a feed from local disk, using the file's
+// modification time in place of HTTP validators to skip unchanged files.
+func (feed Feed) fetchFile(redisClient *redis.Client, path string) (*gofeed.Feed, fetchValidators, error) {
+	ctx := context.Background()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	mtime := info.ModTime().UTC().Format(time.RFC3339Nano)
+
+	previous, err := redisClient.HGet(ctx, fetchStateKey(feed.ID), "mtime").Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Unable to read fetch state for feed %s from Redis: %v", feed.Name, err)
+	}
+	if previous == mtime {
+		return nil, nil, errNotModified
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	rss, err := gofeed.NewParser().ParseString(string(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return rss, fetchValidators{"mtime": mtime}, nil
+}
+
+// fetch retrieves and parses the feed document, sending the validators from the
+// previous fetch so unchanged feeds can be skipped without re-downloading them.
+// The validators of this fetch are returned for the caller to save once it has
+// dealt with the items.
+func (feed Feed) fetch(redisClient *redis.Client) (*gofeed.Feed, fetchValidators, error) {
+	if path := localFeedPath(feed.FeedURL); path != "" {
+		return feed.fetchFile(redisClient, path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), feed.FetchTimeout)
+	defer cancel()
+
+	state, err := redisClient.HGetAll(ctx, fetchStateKey(feed.ID)).Result()
+	if err != nil {
+		// Not fatal, we just lose the ability to make a conditional request
+		log.Printf("Unable to read fetch state for feed %s from Redis: %v", feed.Name, err)
+	}
+	if discovered := state["discovered_url"]; feed.AutoDiscover && discovered != "" {
+		feed.FeedURL = discovered
+	}
+	sourceURL := feed.FeedURL
+	if feed.PersistRedirects && state["redirect_from"] == sourceURL && state["redirect_to"] != "" {
+		// Skip the redirect hop now we know where the feed lives
+		feed.FeedURL = state["redirect_to"]
+		feedRedirectedGauge.WithLabelValues(feed.Name, redactURL(feed.FeedURL)).Set(1)
+	}
+
+	req, err := feed.newRequest(ctx, feed.FeedURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if etag := state["etag"]; etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := state["last_modified"]; lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := feed.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.StatusCode != http.StatusNotModified {
+		// Only returned when follow_redirects is false
+		return nil, nil, fmt.Errorf("%s redirected to %s and follow_redirects is false", redactURL(feed.FeedURL), redactURL(resp.Header.Get("Location")))
+	}
+	feed.noteRedirect(ctx, redisClient, state, sourceURL, resp)
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil, errNotModified
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, nil, fmt.Errorf("authentication failed for %s: %s", redactURL(feed.FeedURL), resp.Status)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("unexpected HTTP status %s from %s", resp.Status, redactURL(feed.FeedURL))
+	}
+
+	wire := &countingReader{reader: resp.Body}
+	decoded, err := decodeBody(wire, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w from %s", err, redactURL(feed.FeedURL))
+	}
+	body, err := io.ReadAll(decoded)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, err
+	}
+	feedResponseSizeHistogram.WithLabelValues(feed.Name, "wire").Observe(float64(wire.count))
+	feedResponseSizeHistogram.WithLabelValues(feed.Name, "decoded").Observe(float64(len(body)))
+
+	rss, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		if feed.AutoDiscover && strings.Contains(resp.Header.Get("Content-Type"), "html") {
+			return feed.fetchDiscovered(redisClient, body, resp.Request.URL, err)
+		}
+		return nil, nil, err
+	}
+	if feed.FollowArchive {
+		if rss.Custom == nil {
+			rss.Custom = make(map[string]string)
+		}
+		rss.Custom[prevArchiveKey] = prevArchiveLink(body, resp.Request.URL)
+	}
+
+	return rss, fetchValidators{"etag": resp.Header.Get("ETag"), "last_modified": resp.Header.Get("Last-Modified")}, nil
+}
+
+// fetchDiscovered looks for a feed advertised by the HTML page that was
+// returned in place of a feed, remembers it and fetches it instead. parseErr is
+// returned unchanged when the page doesn't advertise a feed.
+func (feed Feed) fetchDiscovered(redisClient *redis.Client, page []byte, pageURL *url.URL, parseErr error) (*gofeed.Feed, fetchValidators, error) {
+	discovered := discoverFeedURL(page, pageURL)
+	if discovered == "" {
+		return nil, nil, parseErr
+	}
+	log.Printf("Discovered feed %s for %s from %s", redactURL(discovered), feed.Name, redactURL(pageURL.String()))
+
+	err := redisClient.HSet(context.Background(), fetchStateKey(feed.ID), "discovered_url", discovered).Err()
+	if err != nil {
+		log.Printf("Unable to persist discovered URL for feed %s in Redis: %v", feed.Name, err)
+	}
+
+	// Don't go looking again if the advertised feed turns out to be HTML too
+	feed.FeedURL = discovered
+	feed.AutoDiscover = false
+	return feed.fetch(redisClient)
+}
+
+// decodeBody wraps a response body in a reader undoing its Content-Encoding.
+func decodeBody(body io.Reader, contentEncoding string) (io.Reader, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(contentEncoding)); encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// Meant to be zlib wrapped, but some servers send raw deflate
+		buffered := bufio.NewReader(body)
+		if header, err := buffered.Peek(2); err == nil && isZlibHeader(header) {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+}
+
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Values for Feed.AuthorlessPolicy, deciding what happens to items without any
+// author information.
+const (
+	authorlessPass = "pass"
+	authorlessDrop = "drop"
+)
+
+// compileFilters compiles the feed's title filters, failing on invalid patterns.
+func (feed *Feed) compileFilters() error {
+	var err error
+	if feed.IncludeTitleRegex != "" {
+		if feed.includeTitle, err = regexp.Compile(feed.IncludeTitleRegex); err != nil {
+			return fmt.Errorf("invalid include_title_regex: %w", err)
+		}
+	}
+	if feed.ExcludeTitleRegex != "" {
+		if feed.excludeTitle, err = regexp.Compile(feed.ExcludeTitleRegex); err != nil {
+			return fmt.Errorf("invalid exclude_title_regex: %w", err)
+		}
+	}
+	if feed.CloseOnPattern != "" {
+		if feed.closePattern, err = regexp.Compile(feed.CloseOnPattern); err != nil {
+			return fmt.Errorf("invalid close_on_pattern: %w", err)
+		}
+	}
+	switch feed.AuthorlessPolicy {
+	case "", authorlessPass, authorlessDrop:
+	default:
+		return fmt.Errorf("invalid authorless_policy %q, must be %q or %q", feed.AuthorlessPolicy, authorlessPass, authorlessDrop)
+	}
+	return nil
+}
+
+// filterReason explains why the item is filtered out of the feed, or returns an
+// empty string when it should be synced.
+func (feed Feed) filterReason(item *gofeed.Item) string {
+	if reason := feed.titleFilterReason(item); reason != "" {
+		return reason
+	}
+	if reason := feed.categoryFilterReason(item); reason != "" {
+		return reason
+	}
+	return feed.authorFilterReason(item)
+}
+
+func (feed Feed) titleFilterReason(item *gofeed.Item) string {
+	// Titles have to match the include pattern, and a match always wins over
+	// the exclude pattern.
+	if feed.includeTitle != nil {
+		if !feed.includeTitle.MatchString(item.Title) {
+			return "title doesn't match include_title_regex"
+		}
+		return ""
+	}
+	if feed.excludeTitle != nil && feed.excludeTitle.MatchString(item.Title) {
+		return "title matches exclude_title_regex"
+	}
+	return ""
+}
+
+func (feed Feed) categoryFilterReason(item *gofeed.Item) string {
+	if excluded := matchingCategories(item, feed.ExcludeCategories); len(excluded) > 0 {
+		return fmt.Sprintf("categorised as %s which is in exclude_categories", strings.Join(excluded, ", "))
+	}
+	if len(feed.IncludeCategories) > 0 && len(matchingCategories(item, feed.IncludeCategories)) == 0 {
+		return "no category in include_categories"
+	}
+	return ""
+}
+
+// matchingCategories returns the item's categories that appear in wanted,
+// compared case-insensitively.
+func matchingCategories(item *gofeed.Item, wanted []string) []string {
+	var matches []string
+	for _, category := range item.Categories {
+		for _, candidate := range wanted {
+			if strings.EqualFold(strings.TrimSpace(category), strings.TrimSpace(candidate)) {
+				matches = append(matches, category)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func (feed Feed) authorFilterReason(item *gofeed.Item) string {
+	authors := itemAuthors(item)
+	if len(authors) == 0 {
+		if feed.AuthorlessPolicy == authorlessDrop {
+			return "no author information and authorless_policy is drop"
+		}
+		return ""
+	}
+	if containsFold(feed.ExcludeAuthors, authors) {
+		return "author is in exclude_authors"
+	}
+	if len(feed.IncludeAuthors) > 0 && !containsFold(feed.IncludeAuthors, authors) {
+		return "no author in include_authors"
+	}
+	return ""
+}
+
+// itemAuthors collects the names and email addresses of the item's authors.
+func itemAuthors(item *gofeed.Item) []string {
+	var authors []string
+	for _, person := range append([]*gofeed.Person{item.Author}, item.Authors...) {
+		if person == nil {
+			continue
+		}
+		for _, value := range []string{person.Name, person.Email} {
+			if value = strings.TrimSpace(value); value != "" {
+				authors = append(authors, value)
+			}
+		}
+	}
+	return authors
+}
+
+// containsFold reports whether any of values is in list, ignoring case.
+func containsFold(list, values []string) bool {
+	for _, value := range values {
+		for _, candidate := range list {
+			if strings.EqualFold(strings.TrimSpace(candidate), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
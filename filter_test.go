@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestTitleFilterReason(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		title   string
+		want    string
+	}{
+		{"no filters", "", "", "Anything", ""},
+		{"include match", "CVE-", "", "CVE-2024-1", ""},
+		{"include miss", "CVE-", "", "Webinar", "title doesn't match include_title_regex"},
+		{"exclude match", "", "webinar", "Our webinar", "title matches exclude_title_regex"},
+		{"exclude miss", "", "webinar", "Release notes", ""},
+		{"both, include wins", "CVE-", "webinar", "CVE-2024-1 webinar", ""},
+		{"both, exclude match only", "CVE-", "webinar", "Our webinar", "title doesn't match include_title_regex"},
+		{"both, neither matches", "CVE-", "webinar", "Release notes", "title doesn't match include_title_regex"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed := Feed{IncludeTitleRegex: test.include, ExcludeTitleRegex: test.exclude}
+			if err := feed.compileFilters(); err != nil {
+				t.Fatal(err)
+			}
+			if got := feed.titleFilterReason(&gofeed.Item{Title: test.title}); got != test.want {
+				t.Errorf("titleFilterReason(%q) = %q, want %q", test.title, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCategoryFilterReason(t *testing.T) {
+	feed := Feed{IncludeCategories: []string{"Security"}, ExcludeCategories: []string{"marketing"}}
+	tests := []struct {
+		categories []string
+		want       string
+	}{
+		{[]string{"security "}, ""},
+		{[]string{"security", "Marketing"}, "categorised as Marketing which is in exclude_categories"},
+		{[]string{"release"}, "no category in include_categories"},
+		{nil, "no category in include_categories"},
+	}
+	for _, test := range tests {
+		if got := feed.categoryFilterReason(&gofeed.Item{Categories: test.categories}); got != test.want {
+			t.Errorf("categoryFilterReason(%v) = %q, want %q", test.categories, got, test.want)
+		}
+	}
+}
+
+func TestAuthorFilterReason(t *testing.T) {
+	item := &gofeed.Item{Author: &gofeed.Person{Name: "Alice", Email: "alice@example.com"}}
+	if got := (Feed{ExcludeAuthors: []string{"ALICE@example.com"}}).authorFilterReason(item); got != "author is in exclude_authors" {
+		t.Errorf("excluded author: got %q", got)
+	}
+	if got := (Feed{IncludeAuthors: []string{"bob"}}).authorFilterReason(item); got != "no author in include_authors" {
+		t.Errorf("author not included: got %q", got)
+	}
+	if got := (Feed{AuthorlessPolicy: authorlessDrop}).authorFilterReason(&gofeed.Item{}); got == "" {
+		t.Error("authorless item passed with authorless_policy drop")
+	}
+	if got := (Feed{}).authorFilterReason(&gofeed.Item{}); got != "" {
+		t.Errorf("authorless item dropped by default: %q", got)
+	}
+}
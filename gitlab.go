@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// gitlabInstances holds a client per Gitlab instance feeds sync to, keyed by
+// API base URL.
+type gitlabInstances map[string]*gitlab.Client
+
+// newGitlabInstances creates the client for the default instance from the
+// environment, and one for each other instance a feed sets gitlab_base_url to,
+// authenticated like the default one: with the token in the feed's
+// gitlab_token_env variable, or read from the file named in that variable
+// suffixed with _FILE, of type gitlab_token_type.
+func newGitlabInstances(env EnvValues, config *Config) (gitlabInstances, error) {
+	client, err := newGitlabClient(env.GitlabAPIBaseUrl, env.GitlabTokenType, env.GitlabAPIKey, env.GitlabTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	gitlabs := gitlabInstances{env.GitlabAPIBaseUrl: client}
+	tokenEnvs := map[string]string{env.GitlabAPIBaseUrl: "GITLAB_API_TOKEN"}
+	tokenTypes := map[string]string{env.GitlabAPIBaseUrl: env.GitlabTokenType}
+
+	for i := range config.Feeds {
+		feed := &config.Feeds[i]
+		if feed.GitlabBaseURL == "" {
+			feed.GitlabBaseURL = env.GitlabAPIBaseUrl
+		}
+		if feed.GitlabTokenEnv == "" && feed.GitlabTokenType != "" {
+			return nil, fmt.Errorf("feed %s sets gitlab_token_type without gitlab_token_env", feed.Name)
+		}
+		if feed.GitlabBaseURL == env.GitlabAPIBaseUrl && feed.GitlabTokenEnv == "" {
+			continue
+		}
+		if feed.GitlabTokenEnv == "" {
+			return nil, fmt.Errorf("feed %s sets gitlab_base_url without gitlab_token_env", feed.Name)
+		}
+		tokenType := feed.GitlabTokenType
+		if tokenType == "" {
+			tokenType = "pat"
+		}
+		if previous, ok := tokenEnvs[feed.GitlabBaseURL]; ok {
+			if previous != feed.GitlabTokenEnv {
+				return nil, fmt.Errorf("feed %s uses %s for %s, other feeds use %s", feed.Name, feed.GitlabTokenEnv, feed.GitlabBaseURL, previous)
+			}
+			if tokenTypes[feed.GitlabBaseURL] != tokenType {
+				return nil, fmt.Errorf("feed %s uses a %s token for %s, other feeds use a %s token", feed.Name, tokenType, feed.GitlabBaseURL, tokenTypes[feed.GitlabBaseURL])
+			}
+			continue
+		}
+		token, path := os.Getenv(feed.GitlabTokenEnv), os.Getenv(feed.GitlabTokenEnv+"_FILE")
+		if token == "" && path == "" {
+			return nil, fmt.Errorf("could not find %s or %s_FILE specified as an environment variable for feed %s", feed.GitlabTokenEnv, feed.GitlabTokenEnv, feed.Name)
+		}
+		client, err := newGitlabClient(feed.GitlabBaseURL, tokenType, token, path)
+		if err != nil {
+			return nil, fmt.Errorf("creating Gitlab client for %s: %w", feed.GitlabBaseURL, err)
+		}
+		gitlabs[feed.GitlabBaseURL] = client
+		tokenEnvs[feed.GitlabBaseURL] = feed.GitlabTokenEnv
+		tokenTypes[feed.GitlabBaseURL] = tokenType
+		log.Printf("Feeds with gitlab_base_url %s sync to that instance", feed.GitlabBaseURL)
+	}
+	return gitlabs, nil
+}
+
+// forFeed returns the client for the instance the feed syncs to.
+func (gitlabs gitlabInstances) forFeed(feed Feed) *gitlab.Client {
+	return gitlabs[feed.GitlabBaseURL]
+}
+
+// gitlabStatus is what /status reports about a Gitlab instance.
+type gitlabStatus struct {
+	BaseURL   string `json:"base_url"`
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// check asks every instance for its version to confirm it can be reached with
+// the configured token.
+func (gitlabs gitlabInstances) check() []gitlabStatus {
+	statuses := make([]gitlabStatus, 0, len(gitlabs))
+	for baseURL, client := range gitlabs {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		status := gitlabStatus{BaseURL: baseURL}
+		version, _, err := client.Version.GetVersion(gitlab.WithContext(ctx))
+		cancel()
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Reachable = true
+			status.Version = version.Version
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].BaseURL < statuses[j].BaseURL })
+	return statuses
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// defaultWorkItemType is the work item type created by use_graphql feeds that
+// don't set work_item_type.
+const defaultWorkItemType = "Issue"
+
+const workItemTypesQuery = `query($path: ID!) {
+  project(fullPath: $path) { workItemTypes { nodes { id name } } }
+}`
+
+const workItemCreateMutation = `mutation($input: WorkItemCreateInput!) {
+  workItemCreate(input: $input) { workItem { iid webUrl } errors }
+}`
+
+// graphQL runs a query against the instance's GraphQL API through the REST
+// client, so it is authenticated, rate limited and retried the same way, with
+// mutations retried as creating requests are. data receives the response's
+// data.
+func graphQL(gitlabClient *gitlab.Client, query string, variables map[string]any, data any) error {
+	endpoint := gitlabClient.BaseURL()
+	endpoint.Path = strings.TrimSuffix(strings.TrimSuffix(endpoint.Path, "/"), "/v4") + "/graphql"
+	endpoint.RawPath = ""
+	toGraphQL := func(req *retryablehttp.Request) error {
+		req.URL = endpoint
+		return nil
+	}
+
+	ctx := context.Background()
+	if strings.HasPrefix(query, "mutation") {
+		ctx = creating(ctx)
+	}
+	body := map[string]any{"query": query, "variables": variables}
+	req, err := gitlabClient.NewRequest(http.MethodPost, "graphql", body, []gitlab.RequestOptionFunc{toGraphQL, gitlab.WithContext(ctx)})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Data   any
+		Errors []struct{ Message string }
+	}
+	resp.Data = data
+	if _, err := gitlabClient.Do(req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		messages := make([]string, 0, len(resp.Errors))
+		for _, e := range resp.Errors {
+			messages = append(messages, e.Message)
+		}
+		return errors.New(strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// workItemLookups caches, per instance and project, what creating work items
+// needs looked up: the project's path, its work item type IDs and label IDs.
+var workItemLookups = struct {
+	sync.Mutex
+	paths  map[string]string
+	types  map[string]string
+	labels map[string]int
+}{paths: make(map[string]string), types: make(map[string]string), labels: make(map[string]int)}
+
+// createWorkItem is createIssue for feeds with use_graphql, creating a work
+// item of the feed's work_item_type with the GraphQL workItemCreate mutation
+// from the options createIssue would use. The issue returned only has the
+// project, IID and URL set.
+func (feed Feed) createWorkItem(gitlabClient *gitlab.Client, item *gofeed.Item, options *gitlab.CreateIssueOptions) (*gitlab.Issue, error) {
+	projectKey := fmt.Sprintf("%s %d", feed.GitlabBaseURL, feed.GitlabProjectID)
+	path, typeID, err := feed.workItemProject(gitlabClient, projectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	input := map[string]any{
+		"namespacePath":     path,
+		"workItemTypeId":    typeID,
+		"title":             *options.Title,
+		"descriptionWidget": map[string]any{"description": *options.Description},
+	}
+	if options.Confidential != nil {
+		input["confidential"] = *options.Confidential
+	}
+	if options.Labels != nil && len(*options.Labels) > 0 {
+		input["labelsWidget"] = map[string]any{"labelIds": feed.labelGlobalIDs(gitlabClient, projectKey, *options.Labels)}
+	}
+	if options.AssigneeIDs != nil {
+		var assignees []string
+		for _, id := range *options.AssigneeIDs {
+			assignees = append(assignees, fmt.Sprintf("gid://gitlab/User/%d", id))
+		}
+		input["assigneesWidget"] = map[string]any{"assigneeIds": assignees}
+	}
+	if options.MilestoneID != nil {
+		input["milestoneWidget"] = map[string]any{"milestoneId": fmt.Sprintf("gid://gitlab/Milestone/%d", *options.MilestoneID)}
+	}
+	if options.DueDate != nil {
+		input["startAndDueDateWidget"] = map[string]any{"dueDate": options.DueDate.String(), "isFixed": true}
+	}
+	if options.Weight != nil {
+		input["weightWidget"] = map[string]any{"weight": *options.Weight}
+	}
+	if feed.Retroactive && options.CreatedAt != nil {
+		input["createdAt"] = options.CreatedAt
+	}
+
+	var data struct {
+		WorkItemCreate struct {
+			WorkItem *struct {
+				IID    string
+				WebURL string `json:"webUrl"`
+			} `json:"workItem"`
+			Errors []string
+		} `json:"workItemCreate"`
+	}
+	if err := graphQL(gitlabClient, workItemCreateMutation, map[string]any{"input": input}, &data); err != nil {
+		return nil, err
+	}
+	created := data.WorkItemCreate
+	if len(created.Errors) > 0 || created.WorkItem == nil {
+		return nil, fmt.Errorf("creating work item: %s", strings.Join(created.Errors, "; "))
+	}
+	iid, err := strconv.Atoi(created.WorkItem.IID)
+	if err != nil {
+		return nil, fmt.Errorf("work item created with unexpected IID %q", created.WorkItem.IID)
+	}
+	return &gitlab.Issue{ProjectID: feed.GitlabProjectID, IID: iid, WebURL: created.WorkItem.WebURL}, nil
+}
+
+// workItemProject returns the project's full path and the global ID of the
+// feed's work item type in it, looking them up the first time.
+func (feed Feed) workItemProject(gitlabClient *gitlab.Client, projectKey string) (string, string, error) {
+	typeName := feed.WorkItemType
+	if typeName == "" {
+		typeName = defaultWorkItemType
+	}
+
+	workItemLookups.Lock()
+	defer workItemLookups.Unlock()
+	path, ok := workItemLookups.paths[projectKey]
+	if !ok {
+		project, _, err := gitlabClient.Projects.GetProject(feed.GitlabProjectID, nil, gitlab.WithContext(context.Background()))
+		if err != nil {
+			return "", "", fmt.Errorf("looking up project %d: %w", feed.GitlabProjectID, err)
+		}
+		path = project.PathWithNamespace
+		workItemLookups.paths[projectKey] = path
+
+		var data struct {
+			Project struct {
+				WorkItemTypes struct {
+					Nodes []struct{ ID, Name string }
+				} `json:"workItemTypes"`
+			}
+		}
+		if err := graphQL(gitlabClient, workItemTypesQuery, map[string]any{"path": path}, &data); err != nil {
+			delete(workItemLookups.paths, projectKey)
+			return "", "", fmt.Errorf("listing the work item types of %s: %w", path, err)
+		}
+		for _, workItemType := range data.Project.WorkItemTypes.Nodes {
+			workItemLookups.types[projectKey+" "+strings.ToLower(workItemType.Name)] = workItemType.ID
+		}
+	}
+
+	typeID, ok := workItemLookups.types[projectKey+" "+strings.ToLower(typeName)]
+	if !ok {
+		return "", "", fmt.Errorf("project %s has no work item type %s", path, typeName)
+	}
+	return path, typeID, nil
+}
+
+// labelGlobalIDs returns the GraphQL IDs of the labels, as work items only take
+// existing labels by ID. Labels the project doesn't have are left out with a
+// warning, Gitlab doesn't create them as it does for issues.
+func (feed Feed) labelGlobalIDs(gitlabClient *gitlab.Client, projectKey string, labels []string) []string {
+	workItemLookups.Lock()
+	defer workItemLookups.Unlock()
+	var ids []string
+	for _, label := range labels {
+		key := projectKey + " " + strings.ToLower(label)
+		id, ok := workItemLookups.labels[key]
+		if !ok {
+			found, _, err := gitlabClient.Labels.GetLabel(feed.GitlabProjectID, label, gitlab.WithContext(context.Background()))
+			if err != nil {
+				log.Printf("WARNING: leaving label %s off a work item from %s, it can't be found in project %d: %v", label, feed.Name, feed.GitlabProjectID, err)
+				continue
+			}
+			id = found.ID
+			workItemLookups.labels[key] = id
+		}
+		ids = append(ids, fmt.Sprintf("gid://gitlab/Label/%d", id))
+	}
+	return ids
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/mmcdole/gofeed"
+)
+
+// GUID normalization modes for Feed.GUIDNormalization.
+const (
+	guidStripQuery    = "strip_query"
+	guidStripFragment = "strip_fragment"
+	guidLowercaseHost = "lowercase_host"
+)
+
+// itemGUID returns the identity used to track the item: its GUID, falling back
+// to its link and then to a hash of its title and published date for feeds
+// that don't provide GUIDs.
+func itemGUID(item *gofeed.Item) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	if item.Link != "" {
+		debugf("Item '%s' has no GUID, using its link %s", item.Title, item.Link)
+		return item.Link
+	}
+	sum := sha256.Sum256([]byte(item.Title + "|" + item.Published))
+	guid := "sha256:" + hex.EncodeToString(sum[:])
+	debugf("Item '%s' has no GUID or link, using hash of title and published date %s", item.Title, guid)
+	return guid
+}
+
+// validateGUIDNormalization rejects unknown normalization modes.
+func (feed Feed) validateGUIDNormalization() error {
+	for _, mode := range feed.GUIDNormalization {
+		switch mode {
+		case guidStripQuery, guidStripFragment, guidLowercaseHost:
+		default:
+			return fmt.Errorf("unknown guid_normalization mode %q", mode)
+		}
+	}
+	return nil
+}
+
+// normalizeGUID applies the feed's normalization modes to a GUID that is a URL,
+// so the same item maps to one key however it is decorated. Other GUIDs are
+// returned unchanged.
+func (feed Feed) normalizeGUID(guid string) string {
+	if len(feed.GUIDNormalization) == 0 {
+		return guid
+	}
+	u, err := url.Parse(guid)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return guid
+	}
+	for _, mode := range feed.GUIDNormalization {
+		switch mode {
+		case guidStripQuery:
+			u.RawQuery = ""
+			u.ForceQuery = false
+		case guidStripFragment:
+			u.Fragment = ""
+			u.RawFragment = ""
+		case guidLowercaseHost:
+			u.Host = strings.ToLower(u.Host)
+		}
+	}
+	return u.String()
+}
+
+// migrateGUID checks whether an item was recorded under its raw GUID, from
+// before normalization was enabled, and if so moves it to the normalized one,
+// along with its entries in the hashes keyed by GUID, in one transaction.
+func (feed Feed) migrateGUID(redisClient *redis.Client, rawGUID, guid string) bool {
+	ctx := context.Background()
+	found, err := redisClient.SIsMember(ctx, feed.ID, rawGUID).Result()
+	if err != nil {
+		log.Printf("Error checking Redis for GUID %s in feed %s: %v", rawGUID, feed.Name, err)
+		return false
+	}
+	if !found {
+		return false
+	}
+
+	hashes := []string{issuesKey(feed.ID), itemsKey(feed.ID), contentHashesKey(feed.ID), syncedAtKey(feed.ID)}
+	values := make([]*redis.StringCmd, len(hashes))
+	_, err = redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, hash := range hashes {
+			values[i] = pipe.HGet(ctx, hash, rawGUID)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		log.Printf("Error migrating GUID %s to %s in Redis for feed %s: %v", rawGUID, guid, feed.Name, err)
+		return true
+	}
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, feed.ID, guid)
+		pipe.SRem(ctx, feed.ID, rawGUID)
+		for i, hash := range hashes {
+			if value, err := values[i].Result(); err == nil {
+				pipe.HSet(ctx, hash, guid, value)
+				pipe.HDel(ctx, hash, rawGUID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error migrating GUID %s to %s in Redis for feed %s: %v", rawGUID, guid, feed.Name, err)
+		return true
+	}
+	debugf("Migrated GUID %s to %s for feed %s", rawGUID, guid, feed.Name)
+	return true
+}
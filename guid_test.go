@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestItemGUID(t *testing.T) {
+	withGUID := &gofeed.Item{GUID: "urn:item:1", Link: "https://example.com/a"}
+	if got := itemGUID(withGUID); got != "urn:item:1" {
+		t.Errorf("itemGUID with a GUID = %q", got)
+	}
+	withLink := &gofeed.Item{Link: "https://example.com/a"}
+	if got := itemGUID(withLink); got != "https://example.com/a" {
+		t.Errorf("itemGUID without a GUID = %q, want the link", got)
+	}
+
+	bare := &gofeed.Item{Title: "Title", Published: "Mon, 01 Jan 2024 00:00:00 GMT"}
+	got := itemGUID(bare)
+	if !strings.HasPrefix(got, "sha256:") {
+		t.Errorf("itemGUID without GUID or link = %q, want a hash", got)
+	}
+	if again := itemGUID(&gofeed.Item{Title: "Title", Published: "Mon, 01 Jan 2024 00:00:00 GMT"}); again != got {
+		t.Errorf("hash isn't stable: %q then %q", got, again)
+	}
+	if other := itemGUID(&gofeed.Item{Title: "Other", Published: bare.Published}); other == got {
+		t.Error("items with different titles got the same hash")
+	}
+}
+
+func TestEmptyGUIDStoredByFallback(t *testing.T) {
+	_, client := newTestRedis(t)
+	feed := Feed{ID: "feed", Name: "feed"}
+	item := &gofeed.Item{Link: "https://example.com/a"}
+
+	if err := feed.markSynced(client, itemGUID(item)); err != nil {
+		t.Fatal(err)
+	}
+	found, err := client.SIsMember(context.Background(), feed.ID, itemGUID(&gofeed.Item{Link: "https://example.com/a"})).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Error("item without a GUID isn't found by its link on the next run")
+	}
+}
+
+func TestNormalizeGUID(t *testing.T) {
+	feed := Feed{GUIDNormalization: []string{guidStripQuery, guidStripFragment, guidLowercaseHost}}
+	variants := []string{
+		"https://Example.com/post/1",
+		"https://example.com/post/1?utm_source=rss",
+		"https://EXAMPLE.com/post/1#comments",
+		"https://example.com/post/1?",
+	}
+	for _, variant := range variants {
+		if got := feed.normalizeGUID(variant); got != "https://example.com/post/1" {
+			t.Errorf("normalizeGUID(%q) = %q", variant, got)
+		}
+	}
+	if got := feed.normalizeGUID("urn:uuid:1234"); got != "urn:uuid:1234" {
+		t.Errorf("GUID that isn't a URL changed to %q", got)
+	}
+	if got := (Feed{}).normalizeGUID("https://Example.com/a?b=1"); got != "https://Example.com/a?b=1" {
+		t.Errorf("GUID changed without normalization: %q", got)
+	}
+}
+
+func TestMigrateGUID(t *testing.T) {
+	server, client := newTestRedis(t)
+	feed := Feed{ID: "feed", Name: "feed"}
+	raw, normalized := "https://example.com/a?ref=rss", "https://example.com/a"
+	server.SAdd(feed.ID, raw)
+	server.HSet(issuesKey(feed.ID), raw, "1#2")
+	server.HSet(contentHashesKey(feed.ID), raw, "abc")
+	server.HSet(syncedAtKey(feed.ID), raw, "1700000000")
+
+	if !feed.migrateGUID(client, raw, normalized) {
+		t.Fatal("raw GUID wasn't found")
+	}
+	if ok, _ := server.SIsMember(feed.ID, normalized); !ok {
+		t.Error("normalized GUID isn't in the set")
+	}
+	if ok, _ := server.SIsMember(feed.ID, raw); ok {
+		t.Error("raw GUID is still in the set")
+	}
+	for key, want := range map[string]string{issuesKey(feed.ID): "1#2", contentHashesKey(feed.ID): "abc", syncedAtKey(feed.ID): "1700000000"} {
+		if got := server.HGet(key, normalized); got != want {
+			t.Errorf("%s[normalized] = %q, want %q", key, got, want)
+		}
+		if got := server.HGet(key, raw); got != "" {
+			t.Errorf("%s[raw] is still %q", key, got)
+		}
+	}
+	if server.Exists(itemsKey(feed.ID)) {
+		t.Error("migration created an item record")
+	}
+
+	if feed.migrateGUID(client, "https://example.com/b?ref=rss", "https://example.com/b") {
+		t.Error("migrated a GUID that was never recorded")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// defaultMaxBodyLength keeps issue bodies well below Gitlab's description size
+// limit when the feed doesn't set max_body_length.
+const defaultMaxBodyLength = 60 * 1024
+
+// defaultMaxDescriptionLength is Gitlab's limit on the size of an issue
+// description, used when the feed doesn't set max_description_length.
+const defaultMaxDescriptionLength = 1000000
+
+// errDescriptionRejected is returned by createIssue when Gitlab refused the
+// description even after it was cut down, so retrying the item is pointless.
+var errDescriptionRejected = errors.New("description rejected by Gitlab")
+
+// itemBody returns the item's text, preferring the description over the
+// content, and falling back to the Media RSS description for video feeds.
+func itemBody(item *gofeed.Item) string {
+	if item.Description != "" {
+		return item.Description
+	}
+	if item.Content != "" {
+		return item.Content
+	}
+	return plainTextToHTML(mediaDescription(item))
+}
+
+// issueBody returns the item's text for use in an issue, converted to Markdown
+// unless the feed is raw_html, and truncated to the feed's max_body_length.
+func (feed Feed) issueBody(item *gofeed.Item) string {
+	body := itemBody(item)
+	base := feed.itemBaseURL(item)
+	if feed.RawHTML {
+		body = resolveRelativeURLs(body, base)
+	} else {
+		converted, err := htmlToMarkdown(body, base)
+		if err != nil {
+			log.Printf("Unable to convert '%s' to Markdown, using it as is: %v", item.Title, err)
+		} else {
+			body = converted
+		}
+	}
+
+	body, truncated := truncateBody(body, feed.MaxBodyLength, item.Link, feed.RawHTML)
+	if truncated {
+		bodyTruncatedCounter.WithLabelValues(feed.Name).Inc()
+	}
+	return body
+}
+
+// issueDescription builds the description of the issue created from item,
+// truncated to the feed's max_description_length. The GUID marker, the
+// markerFor marker and the metadata footer are kept whatever happens so
+// hasExistingGitlabIssue can find it again, as are quick actions ending a
+// description_template, which come last.
+func (feed Feed) issueDescription(item *gofeed.Item) string {
+	description, quickActions := splitQuickActions(feed.fullDescription(item))
+	footer := "\n\n" + markerFor(feed.ID, item.GUID) + feed.metadataFooter(item) + quickActions
+	limit := feed.MaxDescriptionLength - len(footer)
+	if feed.MaxDescriptionLength <= 0 || len(description) <= limit {
+		return description + footer
+	}
+	bodyTruncatedCounter.WithLabelValues(feed.Name).Inc()
+	marker := "\n\n" + guidMarker(item.GUID)
+	description, _ = truncateBody(strings.TrimSuffix(description, marker), limit-len(marker), item.Link, feed.RawHTML)
+	return description + marker + footer
+}
+
+// fullDescription builds the description of the issue created from item, from
+// the feed's description_template when it has one.
+func (feed Feed) fullDescription(item *gofeed.Item) string {
+	if feed.descriptionTemplate != nil {
+		description, err := feed.templatedDescription(item)
+		if err == nil {
+			return description
+		}
+		log.Printf("Unable to render the description of '%s' from %s, using the default: %v", item.Title, feed.Name, err)
+	}
+	description := feed.leadImageSection(item) + mediaMetadataSection(item) + feed.issueBody(item) + feed.attachmentsSection(item)
+	if footer := feed.footer(item); footer != "" {
+		description += "\n\n" + footer
+	}
+	return description + "\n\n" + guidMarker(item.GUID)
+}
+
+// guidMarker hides the GUID in an HTML comment, out of the rendered issue but
+// still found by Gitlab's search. A GUID that would close the comment early is
+// left bare.
+func guidMarker(guid string) string {
+	if strings.Contains(guid, "-->") {
+		return guid
+	}
+	return "<!-- guid: " + guid + " -->"
+}
+
+// truncateBody cuts body down to at most limit bytes, on a rune boundary and,
+// when it is raw HTML, never inside a tag, and appends a pointer to the full
+// article.
+func truncateBody(body string, limit int, link string, rawHTML bool) (string, bool) {
+	if limit <= 0 || len(body) <= limit {
+		return body, false
+	}
+
+	footer := "\n\n…truncated"
+	if link != "" {
+		footer += ", read more at " + link
+	}
+
+	cut := limit - len(footer)
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	body = body[:cut]
+	if open := strings.LastIndex(body, "<"); rawHTML && open > strings.LastIndex(body, ">") {
+		body = body[:open]
+	}
+
+	return body + footer, true
+}
+
+// issueOptions builds the options of the issue created from item, dated
+// issueTime, with everything the feed sets. It also returns the names of the
+// assignees, for the log.
+func (feed Feed) issueOptions(item *gofeed.Item, issueTime *time.Time) (*gitlab.CreateIssueOptions, []string) {
+	labels := feed.issueLabels(item)
+	options := &gitlab.CreateIssueOptions{
+		Title:       gitlab.String(feed.issueTitle(item)),
+		Description: gitlab.String(feed.issueDescription(item)),
+		Labels:      &labels,
+		CreatedAt:   issueTime,
+	}
+	if feed.Confidential {
+		options.Confidential = gitlab.Bool(true)
+	}
+	if feed.Weight != nil {
+		options.Weight = gitlab.Ptr(*feed.Weight)
+	}
+	if feed.IssueType != "" {
+		options.IssueType = gitlab.Ptr(feed.IssueType)
+	}
+	if feed.epicID != 0 {
+		options.EpicID = gitlab.Ptr(feed.epicID)
+	}
+	assignees, assigneeNames := feed.itemAssignees(item)
+	if len(assignees) > 0 {
+		options.AssigneeIDs = gitlab.Ptr(assignees)
+	}
+	if milestoneID := feed.milestone.get(); milestoneID != 0 {
+		options.MilestoneID = gitlab.Ptr(milestoneID)
+	}
+	if feed.dueIn > 0 {
+		// Overdue dates are fine, Gitlab just flags the issue
+		dueDate := gitlab.ISOTime(issueTime.Add(feed.dueIn))
+		options.DueDate = &dueDate
+	}
+	return options, assigneeNames
+}
+
+// createIssue creates the issue for item in the feed's project, or a work item
+// with use_graphql. Options Gitlab rejects are dropped or refreshed, and the
+// creation retried.
+func (feed Feed) createIssue(gitlabClient *gitlab.Client, item *gofeed.Item, options *gitlab.CreateIssueOptions) (*gitlab.Issue, error) {
+	if feed.UseGraphQL {
+		return feed.createWorkItem(gitlabClient, item, options)
+	}
+	issue, resp, err := gitlabClient.Issues.CreateIssue(feed.GitlabProjectID, options, gitlab.WithContext(creating(context.Background())))
+	// A description too long for Gitlab is replaced with a pointer to the item
+	if isDescriptionRejected(resp, err) {
+		log.Printf("Gitlab rejected the description of '%s' from %s, retrying with a short one: %v", item.Title, feed.Name, err)
+		options.Description = gitlab.String("The content of this item is too large for an issue, read it at " + item.Link + "\n\n" + guidMarker(item.GUID) + "\n\n" + markerFor(feed.ID, item.GUID) + feed.metadataFooter(item))
+		issue, resp, err = gitlabClient.Issues.CreateIssue(feed.GitlabProjectID, options, gitlab.WithContext(creating(context.Background())))
+		if isDescriptionRejected(resp, err) {
+			return nil, fmt.Errorf("%w: %v", errDescriptionRejected, err)
+		}
+	}
+	// The milestone may have changed ID since it was resolved
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound && feed.refreshMilestone(gitlabClient) {
+		options.MilestoneID = gitlab.Ptr(feed.milestone.get())
+		issue, resp, err = gitlabClient.Issues.CreateIssue(feed.GitlabProjectID, options, gitlab.WithContext(creating(context.Background())))
+	}
+	// A weight is dropped on tiers without issue weights, which reject it
+	if err != nil && resp != nil && options.Weight != nil &&
+		(resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusForbidden) {
+		log.Printf("WARNING: Gitlab rejected weight %d for an issue from %s, creating it without a weight: %v", *options.Weight, feed.Name, err)
+		options.Weight = nil
+		issue, resp, err = gitlabClient.Issues.CreateIssue(feed.GitlabProjectID, options, gitlab.WithContext(creating(context.Background())))
+	}
+	// So is an epic that doesn't exist or can't be accessed
+	if err != nil && resp != nil && options.EpicID != nil &&
+		(resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound) {
+		log.Printf("Unable to add an issue from %s to epic %d, creating it without the epic: %v", feed.Name, *options.EpicID, err)
+		epicAssociationErrorCounter.WithLabelValues(feed.Name).Inc()
+		options.EpicID = nil
+		issue, _, err = gitlabClient.Issues.CreateIssue(feed.GitlabProjectID, options, gitlab.WithContext(creating(context.Background())))
+	}
+	return issue, err
+}
+
+// isDescriptionRejected reports whether Gitlab refused to create an issue
+// because of its description. Other 400s, like a label or milestone that went
+// away, may not happen again.
+func isDescriptionRejected(resp *gitlab.Response, err error) bool {
+	return err != nil && resp != nil && resp.StatusCode == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(err.Error()), "description")
+}
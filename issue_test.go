@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+func TestTruncateBody(t *testing.T) {
+	const marker = "\n\n…truncated"
+	tests := []struct {
+		name    string
+		body    string
+		limit   int
+		rawHTML bool
+		want    string
+	}{
+		{"short enough", "a < b", 100, false, "a < b"},
+		{"markdown keeps literal <", "if a < b then c and more text here, which goes on for a while", 20 + len(marker), false, "if a < b then c and " + marker},
+		{"markdown keeps autolinks", "see <https://example.com/a/long/path>", 15 + len(marker), false, "see <https://ex" + marker},
+		{"html cut before open tag", `<p>Intro</p><a href="https://example.com">link</a>`, 20 + len(marker), true, "<p>Intro</p>" + marker},
+		{"html cut after closed tag", "<p>Intro</p> more text to cut, which goes on for a while", 17 + len(marker), true, "<p>Intro</p> more" + marker},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _ := truncateBody(test.body, test.limit, "", test.rawHTML)
+			if got != test.want {
+				t.Errorf("truncateBody(%q, %d) = %q, want %q", test.body, test.limit, got, test.want)
+			}
+			if len(got) > test.limit {
+				t.Errorf("truncateBody(%q, %d) is %d bytes", test.body, test.limit, len(got))
+			}
+		})
+	}
+}
+
+func TestTruncateBodyRuneBoundary(t *testing.T) {
+	body := strings.Repeat("é", 100)
+	got, truncated := truncateBody(body, 101, "https://example.com/post", false)
+	if !truncated {
+		t.Fatal("body wasn't truncated")
+	}
+	if !strings.HasSuffix(got, "read more at https://example.com/post") {
+		t.Errorf("missing the pointer to the article: %q", got)
+	}
+	if !strings.HasPrefix(got, "éé") || !utf8.ValidString(got) {
+		t.Errorf("cut inside a rune: %q", got)
+	}
+}
+
+func TestCreateIssueDescriptionRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		second string
+		want   bool
+	}{
+		{"short description rejected too", `{"message": {"description": ["is too long"]}}`, true},
+		{"other validation error", `{"message": {"labels": ["are invalid"]}}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			client := newTestGitlab(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				if requests.Add(1) == 1 {
+					w.Write([]byte(`{"message": {"description": ["is too long (maximum is 1000000 characters)"]}}`))
+					return
+				}
+				w.Write([]byte(test.second))
+			})
+
+			feed := Feed{ID: "feed", GitlabProjectID: 1}
+			item := &gofeed.Item{GUID: "urn:item:1", Link: "https://example.com/post"}
+			_, err := feed.createIssue(client, item, &gitlab.CreateIssueOptions{Title: gitlab.Ptr("Title")})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := errors.Is(err, errDescriptionRejected); got != test.want {
+				t.Errorf("errors.Is(%v, errDescriptionRejected) = %v, want %v", err, got, test.want)
+			}
+			if requests.Load() != 2 {
+				t.Errorf("sent %d requests, want 2", requests.Load())
+			}
+		})
+	}
+}
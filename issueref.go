@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// issuesKey is the Redis hash mapping each GUID of a feed to the issue created
+// for it, as "<project ID>#<IID>". Entries written before the project was
+// recorded hold just the IID.
+func issuesKey(feedID string) string {
+	return feedID + ":issues"
+}
+
+// issueRef identifies the issue an item became. ProjectID is 0 for issues
+// recorded before it was stored, they are in the feed's project.
+type issueRef struct {
+	ProjectID int `json:"project_id,omitempty"`
+	IID       int `json:"iid"`
+}
+
+func (ref issueRef) String() string {
+	return fmt.Sprintf("%d#%d", ref.ProjectID, ref.IID)
+}
+
+func parseIssueRef(value string) (issueRef, error) {
+	project, iid, found := strings.Cut(value, "#")
+	if !found {
+		project, iid = "0", value
+	}
+	var ref issueRef
+	var err error
+	if ref.ProjectID, err = strconv.Atoi(project); err != nil {
+		return issueRef{}, fmt.Errorf("invalid issue reference %q", value)
+	}
+	if ref.IID, err = strconv.Atoi(iid); err != nil {
+		return issueRef{}, fmt.Errorf("invalid issue reference %q", value)
+	}
+	return ref, nil
+}
+
+// rememberIssue records which issue was created for the GUID, returning the
+// reference it recorded.
+func (feed Feed) rememberIssue(redisClient *redis.Client, guid string, issue *gitlab.Issue) issueRef {
+	ref := issueRef{ProjectID: issue.ProjectID, IID: issue.IID}
+	if ref.ProjectID == 0 {
+		ref.ProjectID = feed.GitlabProjectID
+	}
+	if err := redisClient.HSet(context.Background(), issuesKey(feed.ID), guid, ref.String()).Err(); err != nil {
+		log.Printf("Unable to persist issue IID for %s in Redis: %v", guid, err)
+	}
+	return ref
+}
+
+// issueRefs reads the issue references of every GUID of the feed. It returns
+// an empty map when they can't be read, so a check doesn't try again per item.
+func (feed Feed) issueRefs(redisClient *redis.Client) map[string]string {
+	refs, err := redisClient.HGetAll(context.Background(), issuesKey(feed.ID)).Result()
+	if err != nil {
+		log.Printf("Unable to read issue references of feed %s from Redis: %v", feed.Name, err)
+		return map[string]string{}
+	}
+	return refs
+}
+
+// getIssueRef looks up the issue created for a GUID of the feed, reporting
+// false when none was recorded.
+func getIssueRef(ctx context.Context, redisClient *redis.Client, feedID, guid string) (issueRef, bool, error) {
+	value, err := redisClient.HGet(ctx, issuesKey(feedID), guid).Result()
+	if err == redis.Nil {
+		return issueRef{}, false, nil
+	}
+	if err != nil {
+		return issueRef{}, false, err
+	}
+	ref, err := parseIssueRef(value)
+	if err != nil {
+		return issueRef{}, false, err
+	}
+	return ref, true, nil
+}
+
+// issueRefHandler answers which issue an item became, given the feed ID and
+// the item's GUID as the feed and guid query parameters, with the item's record
+// when one was kept.
+func issueRefHandler(redisClient *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		feedID, guid := r.URL.Query().Get("feed"), r.URL.Query().Get("guid")
+		if feedID == "" || guid == "" {
+			http.Error(w, "feed and guid are required", http.StatusBadRequest)
+			return
+		}
+		ref, found, err := getIssueRef(r.Context(), redisClient, feedID, guid)
+		if err != nil {
+			log.Printf("Unable to look up issue for %s in feed %s: %v", guid, feedID, err)
+			http.Error(w, "Unable to look up the issue", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "No issue recorded for this item", http.StatusNotFound)
+			return
+		}
+		response := map[string]interface{}{"feed": feedID, "guid": guid, "issue": ref}
+		if record, found, err := getItem(r.Context(), redisClient, feedID, guid); err != nil {
+			log.Printf("Unable to look up the record of %s in feed %s: %v", guid, feedID, err)
+		} else if found {
+			response["item"] = record
+		}
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			log.Printf("Unable to write issue response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// defaultItemsPageSize and maxItemsPageSize bound how many GUIDs /status/items
+// returns at a time, so listing a huge feed doesn't load its whole set.
+const (
+	defaultItemsPageSize = 100
+	maxItemsPageSize     = 1000
+)
+
+// itemsKey is the Redis hash mapping each GUID of a feed an issue was created
+// for to an itemRecord, as JSON.
+func itemsKey(feedID string) string {
+	return feedID + ":items"
+}
+
+// itemRecord is what is remembered about an item an issue was created for.
+type itemRecord struct {
+	Title     string     `json:"title"`
+	Link      string     `json:"link,omitempty"`
+	Published *time.Time `json:"published,omitempty"`
+	IssueIID  int        `json:"issue_iid"`
+	SyncedAt  time.Time  `json:"synced_at"`
+}
+
+// rememberItem records the item the issue was created for.
+func (feed Feed) rememberItem(redisClient *redis.Client, item *gofeed.Item, issue *gitlab.Issue) {
+	record, err := json.Marshal(itemRecord{
+		Title:     item.Title,
+		Link:      item.Link,
+		Published: itemTime(item),
+		IssueIID:  issue.IID,
+		SyncedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("Unable to encode the record of %s: %v", item.GUID, err)
+		return
+	}
+	if err := redisClient.HSet(context.Background(), itemsKey(feed.ID), item.GUID, record).Err(); err != nil {
+		log.Printf("Unable to persist the record of %s in Redis: %v", item.GUID, err)
+	}
+}
+
+// getItem looks up the record of a GUID of the feed, reporting false when
+// none was kept: the item was skipped, or synced before records were.
+func getItem(ctx context.Context, redisClient *redis.Client, feedID, guid string) (itemRecord, bool, error) {
+	value, err := redisClient.HGet(ctx, itemsKey(feedID), guid).Result()
+	if err == redis.Nil {
+		return itemRecord{}, false, nil
+	}
+	if err != nil {
+		return itemRecord{}, false, err
+	}
+	var record itemRecord
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return itemRecord{}, false, fmt.Errorf("invalid record of %s: %w", guid, err)
+	}
+	return record, true, nil
+}
+
+// syncedItems returns a page of the GUIDs recorded for a feed, starting at
+// cursor, and the cursor of the next page, 0 once there are none left. count
+// is a hint, Redis may return a few more or fewer.
+func syncedItems(ctx context.Context, redisClient *redis.Client, feedID string, cursor uint64, count int64) ([]string, uint64, error) {
+	return redisClient.SScan(ctx, feedID, cursor, "", count).Result()
+}
+
+// itemsHandler lists the GUIDs recorded for the feed given as the feed query
+// parameter, a page at a time: count GUIDs from cursor, the next_cursor of the
+// previous page.
+func itemsHandler(redisClient *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		feedID := query.Get("feed")
+		if feedID == "" {
+			http.Error(w, "feed is required", http.StatusBadRequest)
+			return
+		}
+		var cursor uint64
+		if value := query.Get("cursor"); value != "" {
+			var err error
+			if cursor, err = strconv.ParseUint(value, 10, 64); err != nil {
+				http.Error(w, "cursor must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+		count := int64(defaultItemsPageSize)
+		if value := query.Get("count"); value != "" {
+			var err error
+			if count, err = strconv.ParseInt(value, 10, 64); err != nil || count <= 0 {
+				http.Error(w, "count must be a positive number", http.StatusBadRequest)
+				return
+			}
+			count = min(count, maxItemsPageSize)
+		}
+
+		guids, next, err := syncedItems(r.Context(), redisClient, feedID, cursor, count)
+		if err != nil {
+			log.Printf("Unable to list items of feed %s: %v", feedID, err)
+			http.Error(w, "Unable to list the items", http.StatusInternalServerError)
+			return
+		}
+		if guids == nil {
+			guids = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(map[string]interface{}{"feed": feedID, "guids": guids, "next_cursor": next})
+		if err != nil {
+			log.Printf("Unable to write items response: %v", err)
+		}
+	}
+}
+
+// countSyncedItems records how many GUIDs are recorded as synced for the feed,
+// for the synced_items_total metric and /status.
+func (feed Feed) countSyncedItems(redisClient *redis.Client) {
+	count, err := redisClient.SCard(context.Background(), feed.ID).Result()
+	if err != nil {
+		log.Printf("Unable to count the items of feed %s in Redis: %v", feed.Name, err)
+		return
+	}
+	syncedItemsGauge.WithLabelValues(feed.Name).Set(float64(count))
+	recordSyncedItems(feed, count)
+}
+
+// forgetItem removes a GUID from the feed's synced items, along with the issue
+// record and content hash remembered for it, so it is synced again. It returns how
+// many GUIDs were removed, 0 when it wasn't recorded.
+func forgetItem(ctx context.Context, redisClient *redis.Client, feedID, guid string) (int64, error) {
+	var removed *redis.IntCmd
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.SRem(ctx, feedID, guid)
+		pipe.HDel(ctx, issuesKey(feedID), guid)
+		pipe.HDel(ctx, itemsKey(feedID), guid)
+		pipe.HDel(ctx, syncedAtKey(feedID), guid)
+		pipe.HDel(ctx, contentHashesKey(feedID), guid)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed.Val(), nil
+}
+
+// forgetItems forgets the GUIDs of the feed given to -forget, for items whose
+// issue should be created again.
+func (config *Config) forgetItems(redisClient *redis.Client, feedID string, guids []string) error {
+	var feed *Feed
+	for i := range config.Feeds {
+		if config.Feeds[i].ID == feedID {
+			feed = &config.Feeds[i]
+		}
+	}
+	if feed == nil {
+		return fmt.Errorf("no feed with ID %s", feedID)
+	}
+	if len(guids) == 0 {
+		return fmt.Errorf("no GUIDs given to forget from %s", feed.Name)
+	}
+	// The next fetch mustn't be skipped as unchanged once any GUID is gone,
+	// or its item isn't synced again until the feed changes
+	forgot := false
+	defer func() {
+		if forgot {
+			feed.forgetValidators(redisClient)
+		}
+	}()
+	for _, guid := range guids {
+		removed, err := forgetItem(context.Background(), redisClient, feed.ID, guid)
+		if err != nil {
+			return fmt.Errorf("forgetting %s: %w", guid, err)
+		}
+		if removed == 0 {
+			log.Printf("%s wasn't recorded as synced for %s", guid, feed.Name)
+			continue
+		}
+		forgot = true
+		log.Printf("Forgot %s of %s, it will be synced again", guid, feed.Name)
+	}
+	return nil
+}
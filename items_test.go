@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+func TestCountSyncedItems(t *testing.T) {
+	_, client := newTestRedis(t)
+	syncedItemsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_synced_items_total"}, []string{"feed"})
+	ctx := context.Background()
+	feed := Feed{ID: "feed", Name: "feed"}
+
+	feed.countSyncedItems(client)
+	if got := testutil.ToFloat64(syncedItemsGauge.WithLabelValues(feed.Name)); got != 0 {
+		t.Errorf("feed without items counted %v", got)
+	}
+
+	if err := feed.markSynced(client, "a", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.markSynced(client, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forgetItem(ctx, client, feed.ID, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forgetItem(ctx, client, feed.ID, "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	feed.countSyncedItems(client)
+	if got := testutil.ToFloat64(syncedItemsGauge.WithLabelValues(feed.Name)); got != 2 {
+		t.Errorf("synced_items_total = %v, want 2", got)
+	}
+	statuses.Lock()
+	count := feedStatusFor(feed).SyncedItems
+	statuses.Unlock()
+	if count != 2 {
+		t.Errorf("status reports %d synced items, want 2", count)
+	}
+}
+
+func TestRememberItem(t *testing.T) {
+	_, client := newTestRedis(t)
+	ctx := context.Background()
+	feed := Feed{ID: "feed", Name: "feed"}
+	published := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	item := &gofeed.Item{Title: "Title", Link: "https://example.com/1", GUID: "urn:item:1", PublishedParsed: &published}
+
+	if _, found, err := getItem(ctx, client, feed.ID, item.GUID); found || err != nil {
+		t.Fatalf("found a record before one was kept: %v", err)
+	}
+	before := time.Now().UTC().Add(-time.Second)
+	feed.rememberItem(client, item, &gitlab.Issue{IID: 7})
+
+	record, found, err := getItem(ctx, client, feed.ID, item.GUID)
+	if err != nil || !found {
+		t.Fatalf("record wasn't found: %v", err)
+	}
+	if record.Title != "Title" || record.Link != item.Link || record.IssueIID != 7 ||
+		record.Published == nil || !record.Published.Equal(published) || record.SyncedAt.Before(before) {
+		t.Errorf("got record %+v", record)
+	}
+
+	client.HSet(ctx, itemsKey(feed.ID), "broken", "{")
+	if _, _, err := getItem(ctx, client, feed.ID, "broken"); err == nil {
+		t.Error("invalid record was read without an error")
+	}
+}
+
+func TestForgetItemsSyncsAgain(t *testing.T) {
+	fake := &fakeGitlab{}
+	feed, redisClient, gitlabClient := newTestSync(t, testRSS, fake)
+	config := &Config{Feeds: []Feed{feed}}
+
+	feed.checkFeed(redisClient, gitlabClient)
+	if len(fake.created) != 1 {
+		t.Fatalf("created %v", fake.titles())
+	}
+
+	// Forgetting nothing leaves the feed to be skipped as unchanged
+	if err := config.forgetItems(redisClient, feed.ID, []string{"unknown"}); err != nil {
+		t.Fatal(err)
+	}
+	feed.checkFeed(redisClient, gitlabClient)
+	if len(fake.created) != 1 {
+		t.Fatalf("created %v after forgetting an unknown GUID", fake.titles())
+	}
+
+	if err := config.forgetItems(redisClient, feed.ID, []string{"urn:item:1"}); err != nil {
+		t.Fatal(err)
+	}
+	feed.checkFeed(redisClient, gitlabClient)
+	if got := fake.titles(); len(got) != 2 {
+		t.Errorf("created %v, want the forgotten item created again", got)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// LabelDefinition is how a label from label_definitions is created when a
+// project doesn't have it yet.
+type LabelDefinition struct {
+	Color       string
+	Description string
+	Priority    *int
+}
+
+// projectLabels remembers the labels known to exist in each project, keyed by
+// instance and project, so each project's labels are only listed once.
+var projectLabels = struct {
+	sync.Mutex
+	definitions map[string]LabelDefinition
+	existing    map[string]map[string]bool
+}{existing: make(map[string]map[string]bool)}
+
+// setLabelDefinitions makes the label definitions available to ensureLabels.
+func setLabelDefinitions(definitions map[string]LabelDefinition) {
+	projectLabels.Lock()
+	defer projectLabels.Unlock()
+	projectLabels.definitions = definitions
+}
+
+// ensureLabels creates the labels with a definition that are missing from the
+// feed's project, so Gitlab doesn't make them up with a random color. Failures
+// are logged and left for Gitlab to deal with when the issue is created.
+func (feed Feed) ensureLabels(gitlabClient *gitlab.Client, labels []string) {
+	projectLabels.Lock()
+	defer projectLabels.Unlock()
+	if len(projectLabels.definitions) == 0 {
+		return
+	}
+
+	key := fmt.Sprintf("%s %d", feed.GitlabBaseURL, feed.GitlabProjectID)
+	existing, ok := projectLabels.existing[key]
+	if !ok {
+		var err error
+		if existing, err = listLabels(gitlabClient, feed.GitlabProjectID); err != nil {
+			log.Printf("WARNING: unable to list the labels of project %d: %v", feed.GitlabProjectID, err)
+			return
+		}
+		projectLabels.existing[key] = existing
+	}
+
+	for _, label := range labels {
+		definition, defined := projectLabels.definitions[label]
+		if !defined || existing[strings.ToLower(label)] {
+			continue
+		}
+		options := &gitlab.CreateLabelOptions{
+			Name:        gitlab.String(label),
+			Color:       gitlab.String(definition.Color),
+			Description: gitlab.String(definition.Description),
+			Priority:    definition.Priority,
+		}
+		if _, _, err := gitlabClient.Labels.CreateLabel(feed.GitlabProjectID, options, gitlab.WithContext(context.Background())); err != nil {
+			log.Printf("WARNING: unable to create label %s in project %d: %v", label, feed.GitlabProjectID, err)
+			continue
+		}
+		log.Printf("Created label %s in project %d", label, feed.GitlabProjectID)
+		existing[strings.ToLower(label)] = true
+	}
+}
+
+// listLabels returns the lowercased names of every label usable in the
+// project, including those inherited from its groups.
+func listLabels(gitlabClient *gitlab.Client, projectID int) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	opt := &gitlab.ListLabelsOptions{
+		ListOptions:           gitlab.ListOptions{PerPage: 100},
+		IncludeAncestorGroups: gitlab.Ptr(true),
+	}
+	for {
+		labels, resp, err := gitlabClient.Labels.ListLabels(projectID, opt, gitlab.WithContext(context.Background()))
+		if err != nil {
+			return nil, err
+		}
+		for _, label := range labels {
+			existing[strings.ToLower(label.Name)] = true
+		}
+		if resp.NextPage == 0 {
+			return existing, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// syncLabels creates the defined labels each feed is configured with, its
+// labels and the targets of its category_label_map, in the feed's project.
+// Dry run feeds, and feeds creating epics, are left alone.
+func (config *Config) syncLabels(gitlabs gitlabInstances) {
+	for _, feed := range config.Feeds {
+		if feed.isDryRun() || feed.targetsEpics() {
+			continue
+		}
+		labels := append([]string{}, feed.Labels...)
+		for _, label := range feed.CategoryLabelMap {
+			labels = append(labels, label)
+		}
+		feed.ensureLabels(gitlabs.forFeed(feed), labels)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// issueLabels returns the labels for an issue created from item: the feed's
+// labels, plus the item's categories when categories_as_labels is set. With
+// include_categories only the categories that matched are added. Categories
+// are renamed through category_label_map, and ones it doesn't list are dropped
+// when passthrough_categories is false.
+func (feed Feed) issueLabels(item *gofeed.Item) gitlab.LabelOptions {
+	labels := append(gitlab.LabelOptions{}, feed.Labels...)
+	if !feed.CategoriesAsLabels {
+		return labels
+	}
+
+	categories := item.Categories
+	if len(feed.IncludeCategories) > 0 {
+		categories = matchingCategories(item, feed.IncludeCategories)
+	}
+	for _, category := range categories {
+		label, mapped := feed.categoryLabel(category)
+		if !mapped && !feed.passesThroughCategories() {
+			continue
+		}
+		if label = sanitizeLabel(label); label != "" && !containsFold(labels, []string{label}) {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// categoryLabel looks the category up in category_label_map, ignoring case,
+// returning the category itself when it isn't mapped.
+func (feed Feed) categoryLabel(category string) (string, bool) {
+	if label, ok := feed.CategoryLabelMap[category]; ok {
+		return label, true
+	}
+	for mapped, label := range feed.CategoryLabelMap {
+		if strings.EqualFold(mapped, category) {
+			return label, true
+		}
+	}
+	return category, false
+}
+
+// maxLabelLength is the longest label title Gitlab accepts, in characters.
+const maxLabelLength = 255
+
+// repeatedColons matches the runs of colons that break scoped labels.
+var repeatedColons = regexp.MustCompile(`:{3,}`)
+
+// sanitizeLabel makes a category usable as a Gitlab label: without commas,
+// surrounding spaces or broken scope separators, and not too long.
+func sanitizeLabel(label string) string {
+	label = repeatedColons.ReplaceAllString(strings.ReplaceAll(label, ",", " "), "::")
+	label = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(label), "::"), "::"))
+	if runes := []rune(label); len(runes) > maxLabelLength {
+		label = strings.TrimSpace(string(runes[:maxLabelLength]))
+	}
+	return label
+}
+
+// validateLabel checks a configured label would be accepted by Gitlab as is.
+// Scoped labels (scope::value) need a scope and value either side of exactly
+// two colons.
+func validateLabel(label string) error {
+	switch {
+	case label == "":
+		return errors.New("empty label")
+	case strings.Contains(label, ","):
+		return errors.New("labels can't contain commas")
+	case strings.TrimSpace(label) != label:
+		return errors.New("leading or trailing spaces")
+	case utf8.RuneCountInString(label) > maxLabelLength:
+		return fmt.Errorf("longer than %d characters", maxLabelLength)
+	case repeatedColons.MatchString(label), strings.HasPrefix(label, "::"), strings.HasSuffix(label, "::"):
+		return errors.New("scoped labels need a scope and a value around ::")
+	}
+	return nil
+}
+
+// checkLabels validates the feed's labels and the targets of its
+// category_label_map. With sanitize, invalid ones are fixed with a warning
+// instead of being an error.
+func (feed *Feed) checkLabels(sanitize bool) error {
+	fix := func(label string) (string, error) {
+		err := validateLabel(label)
+		if err == nil {
+			return label, nil
+		}
+		if !sanitize {
+			return "", fmt.Errorf("label %q: %w", label, err)
+		}
+		fixed := sanitizeLabel(label)
+		log.Printf("WARNING: label %q of feed %s is invalid (%v), using %q", label, feed.Name, err, fixed)
+		return fixed, nil
+	}
+
+	labels := feed.Labels[:0]
+	for _, label := range feed.Labels {
+		fixed, err := fix(label)
+		if err != nil {
+			return err
+		}
+		if fixed != "" {
+			labels = append(labels, fixed)
+		}
+	}
+	feed.Labels = labels
+	for category, label := range feed.CategoryLabelMap {
+		fixed, err := fix(label)
+		if err != nil {
+			return err
+		}
+		feed.CategoryLabelMap[category] = fixed
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateLabel(t *testing.T) {
+	tests := []struct {
+		label string
+		valid bool
+	}{
+		{"rss", true},
+		{"priority::high", true},
+		{"a::b::c", true},
+		{"", false},
+		{"a,b", false},
+		{" rss", false},
+		{"rss ", false},
+		{"priority:::high", false},
+		{"::high", false},
+		{"priority::", false},
+		{strings.Repeat("é", maxLabelLength), true},
+		{strings.Repeat("é", maxLabelLength+1), false},
+	}
+	for _, test := range tests {
+		if err := validateLabel(test.label); (err == nil) != test.valid {
+			t.Errorf("validateLabel(%q) = %v, want valid %v", test.label, err, test.valid)
+		}
+	}
+}
+
+func TestSanitizeLabel(t *testing.T) {
+	tests := []struct {
+		label, want string
+	}{
+		{"rss", "rss"},
+		{" Security, Privacy ", "Security  Privacy"},
+		{"priority:::high", "priority::high"},
+		{"::high::", "high"},
+		{",", ""},
+		{strings.Repeat("é", maxLabelLength+10), strings.Repeat("é", maxLabelLength)},
+	}
+	for _, test := range tests {
+		got := sanitizeLabel(test.label)
+		if got != test.want {
+			t.Errorf("sanitizeLabel(%q) = %q, want %q", test.label, got, test.want)
+		}
+		if got != "" && validateLabel(got) != nil {
+			t.Errorf("sanitizeLabel(%q) = %q, which isn't valid: %v", test.label, got, validateLabel(got))
+		}
+	}
+}
+
+func TestCheckLabels(t *testing.T) {
+	feed := Feed{Name: "feed", Labels: []string{"rss", "a,b", ","}, CategoryLabelMap: map[string]string{"sec": "type:::security"}}
+	if err := feed.checkLabels(false); err == nil {
+		t.Error("invalid labels were accepted without sanitize_labels")
+	}
+
+	if err := feed.checkLabels(true); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"rss", "a b"}; !reflect.DeepEqual(feed.Labels, want) {
+		t.Errorf("labels = %q, want %q", feed.Labels, want)
+	}
+	if got := feed.CategoryLabelMap["sec"]; got != "type::security" {
+		t.Errorf("mapped label = %q", got)
+	}
+}
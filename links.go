@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+)
+
+// defaultTrackingParams are stripped from item links when tracking_params isn't
+// configured. A trailing * matches any parameter with that prefix.
+var defaultTrackingParams = []string{"utm_*", "gclid", "fbclid", "mc_eid"}
+
+// cleanLink removes tracking query parameters from link, leaving the order of
+// the remaining parameters and any fragment untouched.
+func cleanLink(link string, trackingParams []string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.RawQuery == "" {
+		return link
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		name := pair
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			name = pair[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !isTrackingParam(name, trackingParams) {
+			kept = append(kept, pair)
+		}
+	}
+
+	query := strings.Join(kept, "&")
+	if query == u.RawQuery {
+		return link
+	}
+	u.RawQuery = query
+	return u.String()
+}
+
+func isTrackingParam(name string, trackingParams []string) bool {
+	name = strings.ToLower(name)
+	for _, param := range trackingParams {
+		param = strings.ToLower(param)
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// feedBaseURL is the URL relative links in a feed are resolved against: the
+// site the feed links to, falling back to the feed itself. Credentials and the
+// query are dropped from the feed URL first, they would end up in issues.
+func feedBaseURL(rss *gofeed.Feed, feedURL string) string {
+	public := publicURL(feedURL)
+	if rss.Link != "" {
+		return resolveURL(public, rss.Link)
+	}
+	return public
+}
+
+// publicURL strips the userinfo, query and fragment from rawURL, which may hold
+// credentials. It is empty when rawURL can't be parsed.
+func publicURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	return u.String()
+}
+
+// itemBaseURL is the URL relative links in an item's content are resolved
+// against: the item's own link, falling back to the feed's base URL.
+func (feed Feed) itemBaseURL(item *gofeed.Item) string {
+	if item.Link != "" {
+		return resolveURL(feed.baseURL, item.Link)
+	}
+	return feed.baseURL
+}
+
+// resolveURL resolves ref against base, returning ref unchanged when either
+// can't be parsed. Absolute URLs are left alone.
+func resolveURL(base, ref string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
+
+// resolveRelativeURLs rewrites relative href and src attributes in an HTML
+// fragment against base. The fragment is returned untouched if it can't be
+// tokenized or base isn't absolute.
+func resolveRelativeURLs(fragment, base string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil || !baseURL.IsAbs() {
+		return fragment
+	}
+
+	var out strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		// Copied before Token() as it lowercases the buffer in place
+		raw := string(tokenizer.Raw())
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			out.WriteString(raw)
+			continue
+		}
+
+		token := tokenizer.Token()
+		changed := false
+		for i, attr := range token.Attr {
+			if attr.Key != "href" && attr.Key != "src" {
+				continue
+			}
+			if resolved := resolveURL(base, attr.Val); resolved != attr.Val {
+				token.Attr[i].Val = resolved
+				changed = true
+			}
+		}
+		if changed {
+			out.WriteString(token.String())
+		} else {
+			out.WriteString(raw)
+		}
+	}
+	if tokenizer.Err() != io.EOF {
+		return fragment
+	}
+	return out.String()
+}
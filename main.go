@@ -2,12 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,39 +18,65 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	gitlab "gitlab.com/gitlab-org/api/client-go"
-	"gopkg.in/yaml.v3" // Updated to v3
 )
 
 var addr = flag.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
+var debug = flag.Bool("debug", false, "Enable debug logging.")
+var dryRun = flag.Bool("dry-run", false, "Log the issues that would be created without creating them or marking items as synced.")
+var once = flag.Bool("once", false, "Check every enabled feed once and exit.")
+var lenient = flag.Bool("lenient", false, "Warn instead of exiting when a feed's Gitlab project is missing, archived or can't be written to.")
+var forget = flag.String("forget", "", "Forget the GUIDs given as arguments for the feed with this ID, so they are synced again, and exit.")
+var exportPath = flag.String("export", "", "Write the synced GUIDs of every feed to this file, or - for stdout, as line-delimited JSON and exit.")
+var importPath = flag.String("import", "", "Add the synced GUIDs from a file written by -export, or - for stdin, and exit.")
+var pruneOrphans = flag.Bool("prune-orphans", false, "Delete what Redis holds for feeds that are no longer configured, once confirmed on stdin, and exit.")
+var syncLabelsOnly = flag.Bool("sync-labels", false, "Create the labels from label_definitions that feeds use in their projects and exit.")
 var lastRunGauge prometheus.Gauge
 var issuesCreatedCounter prometheus.Counter
 var issueCreationErrorCounter prometheus.Counter
-
-type Config struct {
-	Feeds    []Feed
-	Interval int
-}
-
-type Feed struct {
-	ID              string
-	FeedURL         string `yaml:"feed_url"`
-	Name            string
-	GitlabProjectID int `yaml:"gitlab_project_id"`
-	Labels          []string
-	AddedSince      time.Time `yaml:"added_since"`
-	Retroactive     bool
-}
+var feedNotModifiedCounter *prometheus.CounterVec
+var feedFetchTimeoutCounter *prometheus.CounterVec
+var feedBacklogGauge *prometheus.GaugeVec
+var feedItemsFilteredCounter *prometheus.CounterVec
+var feedEnabledGauge *prometheus.GaugeVec
+var bodyTruncatedCounter *prometheus.CounterVec
+var feedResponseSizeHistogram *prometheus.HistogramVec
+var feedRedirectedGauge *prometheus.GaugeVec
+var issueCreationDeferredCounter *prometheus.CounterVec
+var epicAssociationErrorCounter *prometheus.CounterVec
+var gitlabRateLimitedCounter prometheus.Counter
+var issuesSkippedDryRunCounter *prometheus.CounterVec
+var gitlabSearchErrorCounter *prometheus.CounterVec
+var issuesUpdatedCounter *prometheus.CounterVec
+var issueUpdateErrorCounter *prometheus.CounterVec
+var issuesClosedCounter *prometheus.CounterVec
+var duplicateNotesCounter *prometheus.CounterVec
+var titleDuplicatesCounter *prometheus.CounterVec
+var epicsCreatedCounter prometheus.Counter
+var unmappedAuthorsCounter *prometheus.CounterVec
+var epicCreationErrorCounter prometheus.Counter
+var gitlabAvailableGauge *prometheus.GaugeVec
+var syncedItemsGauge *prometheus.GaugeVec
 
 type EnvValues struct {
 	RedisURL         string
 	RedisPassword    string
 	ConfDir          string
 	GitlabAPIKey     string
+	GitlabTokenFile  string
+	GitlabTokenType  string
 	GitlabAPIBaseUrl string
 	UseSentinel      bool
 }
 
-func hasExistingGitlabIssue(guid string, projectID int, gitlabClient *gitlab.Client) bool {
+// maxSearchPages bounds how many pages of search results hasExistingGitlabIssue
+// goes through looking for an exact GUID match.
+const maxSearchPages = 10
+
+// hasExistingGitlabIssue searches the project for an issue created from the
+// GUID with the instance's dedup strategy, returning the oldest one found, or
+// nil, and how many requests were made to decide. A failed search is an error
+// rather than "not found", so the caller doesn't create a duplicate.
+func hasExistingGitlabIssue(feedID, guid string, projectID int, gitlabClient *gitlab.Client, strategy string) (*gitlab.Issue, int, error) {
 	// Updated for gitlab.com/gitlab-org/api/client-go
 	// Pagination is now typically handled by ListOptions embedded or passed separately.
 	// Assuming SearchIssuesByProject still takes ListOptions directly or within SearchOptions.
@@ -56,50 +84,138 @@ func hasExistingGitlabIssue(guid string, projectID int, gitlabClient *gitlab.Cli
 	searchOpts := &gitlab.SearchOptions{
 		ListOptions: gitlab.ListOptions{ // Embed ListOptions
 			Page:    1,
-			PerPage: 10,
+			PerPage: 100,
 		},
 		// Search query (guid) is passed as the second argument to the function
 	}
-	issues, _, err := gitlabClient.Search.IssuesByProject(projectID, guid, searchOpts) // Pass projectID, guid, and searchOpts
-	if err != nil {
-		log.Printf("Unable to query Gitlab for existing issues for GUID %s: %v\n", guid, err) // Log the error with GUID
+	// The search is fuzzy, so "12345" also finds the issue for "123456". Stop
+	// at the first page with an exact match. The issues scope covers incidents
+	// and test cases too, so this works whatever the feed's issue_type.
+	var issues []*gitlab.Issue
+	scanned, requests := 0, 0
+	for page := 0; page < maxSearchPages && len(issues) == 0; page++ {
+		candidates, resp, err := searchIssues(gitlabClient, projectID, guid, strategy, searchOpts.ListOptions)
+		if err != nil {
+			return nil, page + 1, err
+		}
+		requests = page + 1
+		scanned += len(candidates)
+		for _, candidate := range candidates {
+			if descriptionMatches(candidate.Description, feedID, guid) {
+				issues = append(issues, candidate)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		searchOpts.Page = resp.NextPage
 	}
-	retVal := false
+
+	var retVal *gitlab.Issue
 	if len(issues) == 1 {
-		retVal = true
-		log.Printf("Found existing issues for %s in project (%s). Marking as syncronised.\n", guid, issues[0].WebURL)
+		retVal = issues[0]
+		log.Printf("Found existing issues for %s in project (%s) after scanning %d search results. Marking as syncronised.\n", guid, issues[0].WebURL, scanned)
 
 	} else if len(issues) > 1 {
-		retVal = true
+		retVal = issues[0]
 		var urls []string
 		for _, issue := range issues {
 			urls = append(urls, issue.WebURL)
+			if issue.IID < retVal.IID {
+				retVal = issue
+			}
 		}
 		log.Printf("Found multiple existing issues for %s in project (%s)\n", guid, strings.Join(urls, ", "))
+	} else if scanned > 0 {
+		debugf("None of the %d search results for %s in project %d match it exactly", scanned, guid, projectID)
 	}
 
-	return retVal
+	return retVal, requests, nil
 
 }
 
+// descriptionHasGUID reports whether an issue description carries the GUID in
+// the marker issueDescription adds, or in its metadata footer. Issues created
+// before the marker was introduced have the bare GUID on a line of its own, or
+// after the last <br>, which still matches.
+func descriptionHasGUID(description, guid string) bool {
+	if metadata, ok := parseMetadataFooter(description); ok && metadata.GUID == guid {
+		return true
+	}
+	marker := guidMarker(guid)
+	for _, segment := range descriptionSegments(description) {
+		if segment == marker || segment == guid {
+			return true
+		}
+	}
+	return false
+}
+
+// descriptionSegments splits a description into its trimmed lines, and those
+// lines on <br>, which separated the body, link and GUID of the first issues.
+func descriptionSegments(description string) []string {
+	var segments []string
+	for _, line := range strings.Split(description, "\n") {
+		for _, segment := range strings.Split(line, "<br>") {
+			segments = append(segments, strings.TrimSpace(segment))
+		}
+	}
+	return segments
+}
+
 func (feed Feed) checkFeed(redisClient *redis.Client, gitlabClient *gitlab.Client) {
-	fp := gofeed.NewParser()
-	rss, err := fp.ParseURL(feed.FeedURL)
+	if until, paused := gitlabAvailability.paused(feed.GitlabBaseURL); paused {
+		debugf("Skipping %s until %s while GitLab %s is unavailable", feed.Name, until.Format(time.RFC850), feed.GitlabBaseURL)
+		return
+	}
+	defer feed.countSyncedItems(redisClient)
 
+	rss, validators, err := feed.fetch(redisClient)
+	if errors.Is(err, errNotModified) {
+		log.Printf("Feed %s not modified since last check, skipping", feed.Name)
+		feedNotModifiedCounter.WithLabelValues(feed.Name).Inc()
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("Timed out fetching feed %s after %s", feed.Name, feed.FetchTimeout)
+		feedFetchTimeoutCounter.WithLabelValues(feed.Name).Inc()
+		return
+	}
 	if err != nil {
 		log.Printf("Unable to parse feed %s: \n %s", feed.Name, err)
 		return
 	}
 
+	// Relative links in the feed's items resolve against this
+	feed.baseURL = feedBaseURL(rss, feed.FeedURL)
+
+	if feed.FollowArchive {
+		feed.backfillArchive(rss, redisClient)
+	}
+
+	// Set when a new item is left unmarked for a later run, which mustn't then
+	// skip the feed as unchanged
+	leftUnmarked := false
+	// The feed's issue references for link_related, read on the first item
+	// that needs them and kept up to date as issues are created
+	var relatedRefs map[string]string
 	var newArticle []*gofeed.Item
 	var oldArticle []*gofeed.Item
 	for _, item := range rss.Items {
+		item.Link = cleanLink(item.Link, feed.TrackingParams)
+		// Everything downstream keys off the GUID, so settle on one up front
+		rawGUID := itemGUID(item)
+		item.GUID = feed.normalizeGUID(rawGUID)
 		// Add context.Background() to SIsMember call
 		found, err := redisClient.SIsMember(context.Background(), feed.ID, item.GUID).Result()
 		if err != nil {
 			log.Printf("Error checking Redis for GUID %s in feed %s: %v", item.GUID, feed.Name, err)
+			leftUnmarked = true
 			continue // Skip this item if Redis check fails
 		}
+		if !found && item.GUID != rawGUID {
+			found = feed.migrateGUID(redisClient, rawGUID, item.GUID)
+		}
 		if found {
 			oldArticle = append(oldArticle, item)
 		} else {
@@ -109,14 +225,31 @@ func (feed Feed) checkFeed(redisClient *redis.Client, gitlabClient *gitlab.Clien
 
 	log.Printf("Checked feed: %s, New articles: %d, Old articles: %d", feed.Name, len(newArticle), len(oldArticle))
 
+	if feed.tracksUpdates() && !feed.isDryRun() {
+		feed.checkUpdates(oldArticle, redisClient, gitlabClient)
+	}
+
+	// Create issues oldest first so their IIDs follow the feed's chronology, and
+	// items deferred by max_items_per_run are always the newest ones
+	sortByItemTime(newArticle)
+
+	cutoff := feed.cutoff()
+	processed, deferred := 0, 0
+	// New items are looked up in one listing of the project's issues when
+	// there are several, falling back to a search for those it can't tell
+	var index *issueIndex
+	indexed := len(newArticle) < 2 || feed.targetsEpics()
+	checked, requests := 0, 0
+	// Set once Gitlab looks to be down, the remaining items are left unmarked
+	unavailable := false
+	// Items before the cutoff are marked together once the loop is done
+	var expired []string
 	for _, item := range newArticle {
-		var itemTime *time.Time
-		// Prefer updated itemTime to published
-		if item.UpdatedParsed != nil {
-			itemTime = item.UpdatedParsed
-		} else {
-			itemTime = item.PublishedParsed
+		if _, paused := gitlabAvailability.paused(feed.GitlabBaseURL); paused {
+			unavailable = true
+			break
 		}
+		itemTime := itemTime(item)
 
 		// Check if itemTime is nil before comparing
 		if itemTime == nil {
@@ -124,34 +257,130 @@ func (feed Feed) checkFeed(redisClient *redis.Client, gitlabClient *gitlab.Clien
 			continue
 		}
 
-		if itemTime.Before(feed.AddedSince) {
-			log.Printf("Ignoring '%s' as its date is before the specified AddedSince (Item: %s vs AddedSince: %s)\n",
-				item.Title, itemTime, feed.AddedSince)
-			// Add context.Background() to SAdd call
-			err := redisClient.SAdd(context.Background(), feed.ID, item.GUID).Err()
+		if itemTime.Before(cutoff) {
+			log.Printf("Ignoring '%s' as its date is before the cutoff from AddedSince/MaxAge (Item: %s vs cutoff: %s)\n",
+				item.Title, itemTime, cutoff)
+			expired = append(expired, item.GUID)
+			continue
+		}
+
+		if feed.MinItemAge > 0 && time.Since(*itemTime) < feed.MinItemAge {
+			// Left unmarked in Redis so it's picked up once it has settled
+			debugf("Deferring '%s' from %s until it is %s old (Item: %s)", item.Title, feed.Name, feed.MinItemAge, itemTime)
+			leftUnmarked = true
+			continue
+		}
+
+		if reason := feed.filterReason(item); reason != "" {
+			log.Printf("Filtered out '%s' from %s: %s", item.Title, feed.Name, reason)
+			feedItemsFilteredCounter.WithLabelValues(feed.Name).Inc()
+			// Remember it so it isn't re-evaluated every run
+			err := feed.markSynced(redisClient, item.GUID)
 			if err != nil {
-				log.Printf("Error adding old GUID %s to Redis for feed %s: %v", item.GUID, feed.Name, err)
+				log.Printf("Error adding filtered GUID %s to Redis for feed %s: %v", item.GUID, feed.Name, err)
+			}
+			continue
+		}
+
+		if feed.MaxItemsPerRun > 0 && processed >= feed.MaxItemsPerRun {
+			// Left unmarked in Redis so it's picked up on the next run
+			deferred++
+			continue
+		}
+		processed++
+
+		if feed.targetsEpics() {
+			if marked, byBudget := feed.syncEpic(redisClient, gitlabClient, item, itemTime); byBudget {
+				deferred++
+			} else if !marked {
+				leftUnmarked = true
 			}
 			continue
 		}
 
 		// Check Gitlab to see if we already have a matching issue there
-		if hasExistingGitlabIssue(item.GUID, feed.GitlabProjectID, gitlabClient) {
+		if !indexed {
+			var made int
+			var err error
+			index, made, err = feed.indexIssues(gitlabClient, newArticle)
+			requests += made
+			if gitlabAvailability.record(feed.GitlabBaseURL, err) {
+				unavailable = true
+				break
+			}
+			if err != nil {
+				log.Printf("Unable to list the issues of project %d for %s, searching for each item instead: %v", feed.GitlabProjectID, feed.Name, err)
+			}
+			indexed = true
+		}
+		checked++
+		existing, resolved := index.lookup(item.GUID)
+		if !resolved {
+			var made int
+			var err error
+			existing, made, err = hasExistingGitlabIssue(feed.ID, item.GUID, feed.GitlabProjectID, gitlabClient, dedupStrategies[feed.GitlabBaseURL])
+			requests += made
+			if gitlabAvailability.record(feed.GitlabBaseURL, err) {
+				unavailable = true
+				break
+			}
+			if err != nil {
+				// Left unmarked in Redis so it's checked again on the next run
+				log.Printf("Unable to query Gitlab for existing issues for GUID %s, skipping '%s' until the next run: %v\n", item.GUID, item.Title, err)
+				gitlabSearchErrorCounter.WithLabelValues(feed.Name).Inc()
+				leftUnmarked = true
+				continue
+			}
+		}
+		if existing != nil {
 			// We think its new but there is already a matching GUID in Gitlab.  Mark as Sync'd
-			// Add context.Background() to SAdd call
-			err := redisClient.SAdd(context.Background(), feed.ID, item.GUID).Err()
+			if feed.OnDuplicate == "comment" && !feed.isDryRun() {
+				feed.noteDuplicate(gitlabClient, existing)
+			}
+			err := feed.markSynced(redisClient, item.GUID)
 			if err != nil {
 				log.Printf("Error adding existing GUID %s to Redis for feed %s: %v", item.GUID, feed.Name, err)
 			}
 			continue
 		}
+		if feed.DedupeByTitle {
+			existing, err := feed.findIssueByTitle(gitlabClient, feed.issueTitle(item))
+			requests++
+			if gitlabAvailability.record(feed.GitlabBaseURL, err) {
+				unavailable = true
+				break
+			}
+			if err != nil {
+				// Left unmarked in Redis so it's checked again on the next run
+				log.Printf("Unable to query Gitlab for issues titled '%s', skipping it until the next run: %v\n", item.Title, err)
+				gitlabSearchErrorCounter.WithLabelValues(feed.Name).Inc()
+				leftUnmarked = true
+				continue
+			}
+			if existing != nil {
+				log.Printf("Found existing issue %s with the title of '%s' under a new GUID %s. Marking as syncronised.", existing.WebURL, item.Title, item.GUID)
+				titleDuplicatesCounter.WithLabelValues(feed.Name).Inc()
+				if feed.OnDuplicate == "comment" && !feed.isDryRun() {
+					feed.noteDuplicate(gitlabClient, existing)
+				}
+				if err := feed.markSynced(redisClient, item.GUID); err != nil {
+					log.Printf("Error adding existing GUID %s to Redis for feed %s: %v", item.GUID, feed.Name, err)
+				} else if !feed.isDryRun() {
+					ref := feed.rememberIssue(redisClient, item.GUID, existing)
+					if relatedRefs != nil {
+						relatedRefs[item.GUID] = ref.String()
+					}
+				}
+				continue
+			}
+		}
 
-		// Prefer description over content
-		var body string
-		if item.Description != "" {
-			body = item.Description
-		} else {
-			body = item.Content
+		// Dry runs don't count, nor do failed creations which give it back
+		if !feed.isDryRun() && !issueCreationBudget.take() {
+			// Left unmarked in Redis so it's picked up on the next run
+			issueCreationDeferredCounter.WithLabelValues(feed.Name).Inc()
+			deferred++
+			continue
 		}
 
 		now := time.Now()
@@ -159,57 +388,189 @@ func (feed Feed) checkFeed(redisClient *redis.Client, gitlabClient *gitlab.Clien
 		if feed.Retroactive {
 			issueTime = itemTime
 		}
+		issueOptions, assigneeNames := feed.issueOptions(item, issueTime)
+		labels := *issueOptions.Labels
 
-		// Correctly pass the address of the LabelOptions slice
-		labels := gitlab.LabelOptions(feed.Labels) // Create the slice first
-		issueOptions := &gitlab.CreateIssueOptions{
-			Title:       gitlab.String(item.Title),
-			Description: gitlab.String(body + "<br>" + item.Link + "<br>" + item.GUID),
-			Labels:      &labels, // Pass the address of the slice
-			CreatedAt:   issueTime,
+		var related *gitlab.Issue
+		if feed.LinkRelated {
+			if relatedRefs == nil {
+				relatedRefs = feed.issueRefs(redisClient)
+			}
+			if related = feed.relatedIssue(gitlabClient, relatedRefs, item); related != nil {
+				issueOptions.Description = gitlab.String(feed.relatedLine(related) + "\n\n" + *issueOptions.Description)
+			}
+		}
+
+		if feed.isDryRun() {
+			// Nothing is created or marked as synced, a real run sees the item as new
+			log.Printf("[dry run] Would create Gitlab issue '%s' in project: %d with labels: %s", item.Title, feed.GitlabProjectID, strings.Join(labels, ", "))
+			issuesSkippedDryRunCounter.WithLabelValues(feed.Name).Inc()
+			continue
 		}
 
-		// Add context.Background() to CreateIssue call using gitlab.WithContext
-		_, _, err := gitlabClient.Issues.CreateIssue(feed.GitlabProjectID, issueOptions, gitlab.WithContext(context.Background()))
+		feed.ensureLabels(gitlabClient, labels)
+		issue, err := feed.createIssue(gitlabClient, item, issueOptions)
+		if err != nil {
+			issueCreationBudget.giveBack()
+		}
+		if gitlabAvailability.record(feed.GitlabBaseURL, err) {
+			issueCreationErrorCounter.Inc()
+			unavailable = true
+			break
+		}
+		if errors.Is(err, errDescriptionRejected) {
+			// It would fail the same way every run, so give up on it for good
+			log.Printf("Unable to create Gitlab issue for %s, marking it as synced: %v\n", item.Title, err)
+			issueCreationErrorCounter.Inc()
+			if err := feed.markSynced(redisClient, item.GUID); err != nil {
+				log.Printf("Unable to persist in %s Redis: %s \n", item.Title, err)
+			}
+			continue
+		}
 		if err != nil {
 			log.Printf("Unable to create Gitlab issue for %s: %v\n", item.Title, err) // Log error with item title
 			issueCreationErrorCounter.Inc()
+			leftUnmarked = true
 			continue
 		}
-		// Add context.Background() to SAdd call
-		err = redisClient.SAdd(context.Background(), feed.ID, item.GUID).Err()
+		err = feed.markSynced(redisClient, item.GUID)
 		if err != nil {
 			log.Printf("Unable to persist in %s Redis: %s \n", item.Title, err)
+			leftUnmarked = true
 			continue
 		}
+		ref := feed.rememberIssue(redisClient, item.GUID, issue)
+		if relatedRefs != nil {
+			relatedRefs[item.GUID] = ref.String()
+		}
+		feed.rememberItem(redisClient, item, issue)
+		if feed.tracksUpdates() {
+			feed.rememberContent(redisClient, item)
+		}
 		issuesCreatedCounter.Inc()
 		if feed.Retroactive {
 			log.Printf("Retroactively issue setting date to %s", itemTime)
 		}
-		log.Printf("Created Gitlab Issue '%s' in project: %d' \n", item.Title, feed.GitlabProjectID)
+		var details string
+		if related != nil {
+			feed.linkRelated(gitlabClient, issue, related)
+			details += ", related to " + related.WebURL
+		}
+		if feed.State == "closed" && feed.closeCreatedIssue(gitlabClient, issue, issueTime) {
+			details += ", closed"
+		}
+		if len(assigneeNames) > 0 {
+			details += ", assigned to " + strings.Join(assigneeNames, ", ")
+		}
+		if issueOptions.DueDate != nil {
+			details += ", due " + issueOptions.DueDate.String()
+		}
+		log.Printf("Created Gitlab Issue '%s' in project: %d%s \n", item.Title, feed.GitlabProjectID, details)
 	}
+
+	if len(expired) > 0 {
+		if err := feed.markSynced(redisClient, expired...); err != nil {
+			log.Printf("Error adding %d old GUIDs to Redis for feed %s: %v", len(expired), feed.Name, err)
+			leftUnmarked = true
+		}
+	}
+	if unavailable {
+		log.Printf("Stopped checking %s while GitLab is unavailable, its remaining new articles are left for after the pause", feed.Name)
+	}
+	if !feed.isDryRun() {
+		if unavailable || leftUnmarked || deferred > 0 {
+			// The next fetch has to return the feed for those items to be retried
+			feed.forgetValidators(redisClient)
+		} else {
+			// Every item was dealt with, the feed can be skipped until it changes
+			feed.saveValidators(redisClient, validators)
+		}
+	}
+	if checked > 0 {
+		log.Printf("Checked %d new articles from %s for existing issues with %d Gitlab requests", checked, feed.Name, requests)
+	}
+	if deferred > 0 {
+		log.Printf("Deferred %d new articles from %s to the next run (max_items_per_run: %d)", deferred, feed.Name, feed.MaxItemsPerRun)
+	}
+	feedBacklogGauge.WithLabelValues(feed.Name).Set(float64(deferred))
+
+	feed.pruneItems(redisClient, rss.Items)
+}
+
+// markSynced records the GUIDs as processed so they aren't looked at again,
+// and when, for the feed's retention, in one transaction. It does nothing in a
+// dry run, leaving the items for a real run.
+func (feed Feed) markSynced(redisClient *redis.Client, guids ...string) error {
+	if feed.isDryRun() || len(guids) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	members := make([]interface{}, len(guids))
+	for i, guid := range guids {
+		members[i] = guid
+	}
+	now := time.Now().Unix()
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, feed.ID, members...)
+		for _, guid := range guids {
+			pipe.HSetNX(ctx, syncedAtKey(feed.ID), guid, now)
+		}
+		return nil
+	})
+	return err
 }
 
-func readConfig(path string) *Config {
-	config := &Config{}
+// isDryRun reports whether issues are only logged instead of created, with
+// -dry-run or the feed's dry_run.
+func (feed Feed) isDryRun() bool {
+	return *dryRun || feed.DryRun
+}
 
-	data, err := os.ReadFile(path) // Use os.ReadFile instead of ioutil.ReadFile
-	if err != nil {
-		log.Fatalf("Error reading config file %s: %v", path, err) // Log the error properly
+// cutoff is the date before which items are ignored: the later of AddedSince
+// and MaxAge ago.
+func (feed Feed) cutoff() time.Time {
+	cutoff := feed.AddedSince
+	if feed.MaxAge > 0 {
+		if maxAgeCutoff := time.Now().Add(-feed.MaxAge); maxAgeCutoff.After(cutoff) {
+			cutoff = maxAgeCutoff
+		}
 	}
+	return cutoff
+}
 
-	if err = yaml.Unmarshal(data, config); err != nil {
-		log.Printf("Unable to parse config YAML \n %s \n", err)
-		panic(err)
+// debugf logs only when running with -debug.
+func debugf(format string, v ...interface{}) {
+	if *debug {
+		log.Printf(format, v...)
 	}
+}
 
-	return config
+// itemTime returns when the item was last updated, falling back to when it was
+// published. It is nil when the feed provides neither.
+func itemTime(item *gofeed.Item) *time.Time {
+	if item.UpdatedParsed != nil {
+		return item.UpdatedParsed
+	}
+	return item.PublishedParsed
 }
 
-func initialise(env EnvValues) (redisClient *redis.Client, client *gitlab.Client, config *Config) {
+// sortByItemTime orders items oldest first, with undated items last.
+func sortByItemTime(items []*gofeed.Item) {
+	sort.SliceStable(items, func(i, j int) bool {
+		ti, tj := itemTime(items[i]), itemTime(items[j])
+		if ti == nil || tj == nil {
+			return ti != nil
+		}
+		return ti.Before(*tj)
+	})
+}
+
+// registerMetrics creates the Prometheus metrics and registers them with the
+// default registry.
+func registerMetrics() {
 	gaugeOpts := prometheus.GaugeOpts{
 		Name: "last_run_time",
-		Help: "Last Run Time in Unix Seconds",
+		Help: "Time the last feed check finished in Unix Seconds",
 	}
 	lastRunGauge = prometheus.NewGauge(gaugeOpts)
 	prometheus.MustRegister(lastRunGauge)
@@ -228,13 +589,203 @@ func initialise(env EnvValues) (redisClient *redis.Client, client *gitlab.Client
 
 	issueCreationErrorCounter = prometheus.NewCounter(issueCreationErrorCountOpts)
 	prometheus.MustRegister(issueCreationErrorCounter)
+
+	feedNotModifiedCounterOpts := prometheus.CounterOpts{
+		Name: "feed_fetch_not_modified_total",
+		Help: "The total of feed fetches skipped because the feed was unchanged (HTTP 304 or unchanged file)",
+	}
+	feedNotModifiedCounter = prometheus.NewCounterVec(feedNotModifiedCounterOpts, []string{"feed"})
+	prometheus.MustRegister(feedNotModifiedCounter)
+
+	feedFetchTimeoutCounterOpts := prometheus.CounterOpts{
+		Name: "feed_fetch_timeout_total",
+		Help: "The total of feed fetches abandoned because they exceeded the fetch timeout",
+	}
+	feedFetchTimeoutCounter = prometheus.NewCounterVec(feedFetchTimeoutCounterOpts, []string{"feed"})
+	prometheus.MustRegister(feedFetchTimeoutCounter)
+
+	feedBacklogGaugeOpts := prometheus.GaugeOpts{
+		Name: "feed_backlog_items",
+		Help: "New articles deferred to a later run by max_items_per_run at the last check",
+	}
+	feedBacklogGauge = prometheus.NewGaugeVec(feedBacklogGaugeOpts, []string{"feed"})
+	prometheus.MustRegister(feedBacklogGauge)
+
+	feedItemsFilteredCounterOpts := prometheus.CounterOpts{
+		Name: "feed_items_filtered_total",
+		Help: "The total of feed items dropped by the feed's filters",
+	}
+	feedItemsFilteredCounter = prometheus.NewCounterVec(feedItemsFilteredCounterOpts, []string{"feed"})
+	prometheus.MustRegister(feedItemsFilteredCounter)
+
+	feedEnabledGaugeOpts := prometheus.GaugeOpts{
+		Name: "feed_enabled",
+		Help: "Whether the feed is enabled (1) or paused (0)",
+	}
+	feedEnabledGauge = prometheus.NewGaugeVec(feedEnabledGaugeOpts, []string{"feed"})
+	prometheus.MustRegister(feedEnabledGauge)
+
+	bodyTruncatedCounterOpts := prometheus.CounterOpts{
+		Name: "issue_body_truncated_total",
+		Help: "The total of issue bodies truncated to the feed's max_body_length or max_description_length",
+	}
+	bodyTruncatedCounter = prometheus.NewCounterVec(bodyTruncatedCounterOpts, []string{"feed"})
+	prometheus.MustRegister(bodyTruncatedCounter)
+
+	feedResponseSizeHistogramOpts := prometheus.HistogramOpts{
+		Name:    "feed_response_size_bytes",
+		Help:    "Size of feed responses as received (stage=wire) and after decompression (stage=decoded)",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 8),
+	}
+	feedResponseSizeHistogram = prometheus.NewHistogramVec(feedResponseSizeHistogramOpts, []string{"feed", "stage"})
+	prometheus.MustRegister(feedResponseSizeHistogram)
+
+	feedRedirectedGaugeOpts := prometheus.GaugeOpts{
+		Name: "feed_redirected",
+		Help: "Set to 1 for feeds whose URL permanently redirects to final_url",
+	}
+	feedRedirectedGauge = prometheus.NewGaugeVec(feedRedirectedGaugeOpts, []string{"feed", "final_url"})
+	prometheus.MustRegister(feedRedirectedGauge)
+
+	issueCreationDeferredCounterOpts := prometheus.CounterOpts{
+		Name: "issue_creation_deferred_total",
+		Help: "The total of new items deferred to a later run by max_issues_per_run",
+	}
+	issueCreationDeferredCounter = prometheus.NewCounterVec(issueCreationDeferredCounterOpts, []string{"feed"})
+	prometheus.MustRegister(issueCreationDeferredCounter)
+
+	epicAssociationErrorCounterOpts := prometheus.CounterOpts{
+		Name: "epic_association_error_total",
+		Help: "The total of issues created without their feed's epic because Gitlab rejected it",
+	}
+	epicAssociationErrorCounter = prometheus.NewCounterVec(epicAssociationErrorCounterOpts, []string{"feed"})
+	prometheus.MustRegister(epicAssociationErrorCounter)
+
+	gitlabRateLimitedCounterOpts := prometheus.CounterOpts{
+		Name: "gitlab_rate_limited_total",
+		Help: "The total of Gitlab API requests retried after a 429 Too Many Requests",
+	}
+	gitlabRateLimitedCounter = prometheus.NewCounter(gitlabRateLimitedCounterOpts)
+	prometheus.MustRegister(gitlabRateLimitedCounter)
+
+	issuesSkippedDryRunCounterOpts := prometheus.CounterOpts{
+		Name: "issues_skipped_dry_run_total",
+		Help: "The total of issues not created because of a dry run",
+	}
+	issuesSkippedDryRunCounter = prometheus.NewCounterVec(issuesSkippedDryRunCounterOpts, []string{"feed"})
+	prometheus.MustRegister(issuesSkippedDryRunCounter)
+
+	gitlabSearchErrorCounterOpts := prometheus.CounterOpts{
+		Name: "gitlab_search_error_total",
+		Help: "The total of items skipped until the next run because the search for an existing issue failed",
+	}
+	gitlabSearchErrorCounter = prometheus.NewCounterVec(gitlabSearchErrorCounterOpts, []string{"feed"})
+	prometheus.MustRegister(gitlabSearchErrorCounter)
+
+	issuesUpdatedCounterOpts := prometheus.CounterOpts{
+		Name: "issues_updated_total",
+		Help: "The total of issues updated because their item changed, for feeds with sync_updates",
+	}
+	issuesUpdatedCounter = prometheus.NewCounterVec(issuesUpdatedCounterOpts, []string{"feed"})
+	prometheus.MustRegister(issuesUpdatedCounter)
+
+	issueUpdateErrorCounterOpts := prometheus.CounterOpts{
+		Name: "issue_update_error_total",
+		Help: "The total of errors updating issues for feeds with sync_updates",
+	}
+	issueUpdateErrorCounter = prometheus.NewCounterVec(issueUpdateErrorCounterOpts, []string{"feed"})
+	prometheus.MustRegister(issueUpdateErrorCounter)
+
+	issuesClosedCounterOpts := prometheus.CounterOpts{
+		Name: "issues_closed_total",
+		Help: "The total of issues closed because their item matched close_on_pattern",
+	}
+	issuesClosedCounter = prometheus.NewCounterVec(issuesClosedCounterOpts, []string{"feed"})
+	prometheus.MustRegister(issuesClosedCounter)
+
+	duplicateNotesCounterOpts := prometheus.CounterOpts{
+		Name: "duplicate_notes_total",
+		Help: "The total of notes added to existing issues for items seen again, for feeds with on_duplicate: comment",
+	}
+	duplicateNotesCounter = prometheus.NewCounterVec(duplicateNotesCounterOpts, []string{"feed"})
+	prometheus.MustRegister(duplicateNotesCounter)
+
+	unmappedAuthorsCounterOpts := prometheus.CounterOpts{
+		Name: "unmapped_authors_total",
+		Help: "The total of items whose author isn't in the feed's author_assignee_map",
+	}
+	unmappedAuthorsCounter = prometheus.NewCounterVec(unmappedAuthorsCounterOpts, []string{"feed"})
+	prometheus.MustRegister(unmappedAuthorsCounter)
+
+	titleDuplicatesCounterOpts := prometheus.CounterOpts{
+		Name: "title_duplicates_total",
+		Help: "The total of new items matched to an existing issue by title, for feeds with dedupe_by_title",
+	}
+	titleDuplicatesCounter = prometheus.NewCounterVec(titleDuplicatesCounterOpts, []string{"feed"})
+	prometheus.MustRegister(titleDuplicatesCounter)
+
+	epicsCreatedCounterOpts := prometheus.CounterOpts{
+		Name: "epic_creation_total",
+		Help: "The total of epics created for feeds with target: epic",
+	}
+	epicsCreatedCounter = prometheus.NewCounter(epicsCreatedCounterOpts)
+	prometheus.MustRegister(epicsCreatedCounter)
+
+	epicCreationErrorCounterOpts := prometheus.CounterOpts{
+		Name: "epic_creation_error_total",
+		Help: "The total of errors creating epics for feeds with target: epic",
+	}
+	epicCreationErrorCounter = prometheus.NewCounter(epicCreationErrorCounterOpts)
+	prometheus.MustRegister(epicCreationErrorCounter)
+
+	gitlabAvailableGaugeOpts := prometheus.GaugeOpts{
+		Name: "gitlab_available",
+		Help: "Whether the Gitlab instance is taken to be available (1) or checks of its feeds are paused after repeated 502/503s or refused connections (0)",
+	}
+	gitlabAvailableGauge = prometheus.NewGaugeVec(gitlabAvailableGaugeOpts, []string{"gitlab"})
+	prometheus.MustRegister(gitlabAvailableGauge)
+
+	syncedItemsGaugeOpts := prometheus.GaugeOpts{
+		Name: "synced_items_total",
+		Help: "The number of GUIDs recorded as synced for the feed at its last check",
+	}
+	syncedItemsGauge = prometheus.NewGaugeVec(syncedItemsGaugeOpts, []string{"feed"})
+	prometheus.MustRegister(syncedItemsGauge)
+}
+
+func initialise(env EnvValues) (redisClient *redis.Client, gitlabs gitlabInstances, config *Config) {
+	registerMetrics()
+
+	config = readConfig(path.Join(env.ConfDir, "config.yaml"))
 	// Updated for gitlab.com/gitlab-org/api/client-go
 	var err error // Declare err variable
-	client, err = gitlab.NewClient(env.GitlabAPIKey, gitlab.WithBaseURL(env.GitlabAPIBaseUrl))
+	gitlabs, err = newGitlabInstances(env, config)
 	if err != nil {
 		log.Fatalf("Failed to create GitLab client: %v", err) // Handle error
 	}
-	config = readConfig(path.Join(env.ConfDir, "config.yaml"))
+	gitlabAvailability = newAvailability(gitlabs, config.UnavailableBackoff)
+	if err := config.resolveProjects(gitlabs); err != nil {
+		log.Fatalf("Unable to resolve project: %v", err)
+	}
+	if err := config.validateProjects(gitlabs); err != nil {
+		if !*lenient {
+			log.Fatalf("Unable to create issues in every project, run with -lenient to start anyway: %v", err)
+		}
+		log.Printf("WARNING: unable to create issues in every project: %v", err)
+	}
+	config.chooseDedupStrategies(gitlabs)
+	if err := config.resolveAssignees(gitlabs); err != nil {
+		log.Fatalf("Unable to resolve assignees: %v", err)
+	}
+	if err := config.resolveMilestones(gitlabs); err != nil {
+		log.Fatalf("Invalid milestone: %v", err)
+	}
+	if err := config.resolveEpics(gitlabs); err != nil {
+		log.Fatalf("Invalid epic: %v", err)
+	}
+	config.warnConfidentialPublic(gitlabs)
+	setLabelDefinitions(config.LabelDefinitions)
+	config.syncLabels(gitlabs)
 
 	if !env.UseSentinel {
 		redisClient = redis.NewClient(&redis.Options{
@@ -262,34 +813,67 @@ func initialise(env EnvValues) (redisClient *redis.Client, client *gitlab.Client
 }
 
 func main() {
+	flag.Parse()
 	env := readEnv()
-	redisClient, gitlabClient, config := initialise(env)
-	go checkLiveliness(redisClient)
-	go func() {
-		for {
-			log.Printf("Running checks at %s\n", time.Now().Format(time.RFC850))
-			for _, configEntry := range config.Feeds {
-				configEntry.checkFeed(redisClient, gitlabClient)
-			}
-			lastRunGauge.SetToCurrentTime()
-			// Use config.Interval for sleep duration
-			sleepDuration := time.Duration(config.Interval) * time.Second
-			if sleepDuration <= 0 {
-				sleepDuration = 10 * time.Minute // Default if interval is invalid
-				log.Printf("Invalid interval in config, using default: %v", sleepDuration)
-			}
-			time.Sleep(sleepDuration)
+	redisClient, gitlabs, config := initialise(env)
+	if *syncLabelsOnly {
+		return
+	}
+	if *exportPath != "" {
+		if err := config.exportToFile(redisClient, *exportPath); err != nil {
+			log.Fatalf("Unable to export items: %v", err)
+		}
+		return
+	}
+	if *importPath != "" {
+		if err := config.importFromFile(redisClient, *importPath); err != nil {
+			log.Fatalf("Unable to import items: %v", err)
+		}
+		return
+	}
+	if *pruneOrphans {
+		confirmed, err := config.confirmPrune(redisClient, os.Stdin, os.Stderr)
+		if err != nil {
+			log.Fatalf("Unable to prune orphaned feeds: %v", err)
+		}
+		if !confirmed {
+			return
 		}
-	}()
+		if err := config.checkOrphanedFeeds(redisClient, true); err != nil {
+			log.Fatalf("Unable to prune orphaned feeds: %v", err)
+		}
+		return
+	}
+	if *forget != "" {
+		if err := config.forgetItems(redisClient, *forget, flag.Args()); err != nil {
+			log.Fatalf("Unable to forget items: %v", err)
+		}
+		return
+	}
+	if err := config.checkOrphanedFeeds(redisClient, config.PruneOrphanedFeeds && !*dryRun); err != nil {
+		log.Printf("Unable to check for orphaned feeds: %v", err)
+	}
+	if *once {
+		runOnce(config, redisClient, gitlabs)
+		return
+	}
+	go checkLiveliness(redisClient)
+	go runScheduler(config, redisClient, gitlabs)
 
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/status", statusHandler(gitlabs))
+	http.HandleFunc("/status/issue", issueRefHandler(redisClient))
+	http.HandleFunc("/status/items", itemsHandler(redisClient))
+	if config.WebhookSecret != "" {
+		http.HandleFunc("/webhook/gitlab", webhookHandler(config, redisClient))
+	}
 	log.Printf("Starting web server on port %s", *addr) // Log server start
 	log.Fatal(http.ListenAndServe(*addr, nil))
 
 }
 
 func readEnv() EnvValues {
-	var gitlabAPIBaseUrl, gitlabPAToken, configDir, redisURL, redisPassword string
+	var gitlabAPIBaseUrl, gitlabPAToken, gitlabTokenFile, gitlabTokenType, configDir, redisURL, redisPassword string
 	useSentinel := false
 
 	if envGitlabAPIBaseUrl := os.Getenv("GITLAB_API_BASE_URL"); envGitlabAPIBaseUrl == "" {
@@ -297,10 +881,21 @@ func readEnv() EnvValues {
 	} else {
 		gitlabAPIBaseUrl = envGitlabAPIBaseUrl
 	}
-	if envGitlabAPIToken := os.Getenv("GITLAB_API_TOKEN"); envGitlabAPIToken == "" {
-		panic("Could not find GITLAB_API_TOKEN specified as an environment variable")
-	} else {
-		gitlabPAToken = envGitlabAPIToken
+	switch gitlabTokenType = os.Getenv("GITLAB_TOKEN_TYPE"); gitlabTokenType {
+	case "":
+		gitlabTokenType = "pat"
+	case "pat", "job", "oauth":
+	default:
+		panic("GITLAB_TOKEN_TYPE must be pat, job or oauth")
+	}
+	gitlabPAToken = os.Getenv("GITLAB_API_TOKEN")
+	gitlabTokenFile = os.Getenv("GITLAB_API_TOKEN_FILE")
+	if gitlabPAToken == "" && gitlabTokenFile == "" && gitlabTokenType == "job" {
+		// Running as a scheduled Gitlab CI job
+		gitlabPAToken = os.Getenv("CI_JOB_TOKEN")
+	}
+	if gitlabPAToken == "" && gitlabTokenFile == "" {
+		panic("Could not find GITLAB_API_TOKEN or GITLAB_API_TOKEN_FILE specified as an environment variable")
 	}
 	if envConfigDir := os.Getenv("CONFIG_DIR"); envConfigDir == "" {
 		panic("Could not find CONFIG_DIR specified as an environment variable")
@@ -331,6 +926,8 @@ func readEnv() EnvValues {
 		RedisPassword:    redisPassword,
 		ConfDir:          configDir,
 		GitlabAPIKey:     gitlabPAToken,
+		GitlabTokenFile:  gitlabTokenFile,
+		GitlabTokenType:  gitlabTokenType,
 		GitlabAPIBaseUrl: gitlabAPIBaseUrl,
 		UseSentinel:      useSentinel,
 	}
@@ -339,12 +936,42 @@ func readEnv() EnvValues {
 func checkLiveliness(client *redis.Client) {
 	// Register health check handler on the main HTTP server
 	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
 		if err := client.Ping(ctx).Err(); err != nil {
 			log.Printf("Health check failed: %v", err)
 			http.Error(w, "Unable to connect to the redis master", http.StatusInternalServerError)
 			return
 		}
+		if err := checkRedisWritable(ctx, client); err != nil {
+			log.Printf("Health check failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		fmt.Fprintf(w, "All is well!")
 	})
 }
+
+// healthCheckKey is written and deleted by checkRedisWritable.
+const healthCheckKey = "rss_gitlab_sync:healthz"
+
+// checkRedisWritable writes and deletes a key in a transaction, as Ping
+// succeeds against a read-only replica or a Redis out of memory while every
+// GUID would fail to be recorded.
+func checkRedisWritable(ctx context.Context, client *redis.Client) error {
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, healthCheckKey, time.Now().Unix(), time.Minute)
+		pipe.Del(ctx, healthCheckKey)
+		return nil
+	})
+	switch {
+	case err == nil:
+		return nil
+	case strings.Contains(err.Error(), "READONLY"):
+		return errors.New("redis is read-only, connected to a replica instead of the master")
+	case strings.Contains(err.Error(), "OOM"):
+		return errors.New("redis is out of memory and refusing writes")
+	default:
+		return fmt.Errorf("unable to write to redis: %w", err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/url"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// htmlToMarkdown converts an item's HTML body to Markdown for the issue
+// description, resolving relative links and images against base.
+func htmlToMarkdown(body, base string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		baseURL = nil
+	}
+
+	options := &md.Options{
+		GetAbsoluteURL: func(_ *goquery.Selection, rawURL string, _ string) string {
+			if baseURL == nil {
+				return rawURL
+			}
+			ref, err := url.Parse(rawURL)
+			if err != nil {
+				return rawURL
+			}
+			return baseURL.ResolveReference(ref).String()
+		},
+	}
+	return md.NewConverter("", true, options).ConvertString(body)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// mediaDescription returns the Media RSS description of an item, which is
+// usually the only text YouTube feeds carry. It looks inside media:group first.
+func mediaDescription(item *gofeed.Item) string {
+	media := item.Extensions["media"]
+	for _, group := range media["group"] {
+		if description := extensionValue(group.Children["description"]); description != "" {
+			return description
+		}
+	}
+	return extensionValue(media["description"])
+}
+
+func extensionValue(extensions []ext.Extension) string {
+	for _, extension := range extensions {
+		if value := strings.TrimSpace(extension.Value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// isMediaItem reports whether the item comes from a podcast or video feed,
+// going by the iTunes, Media RSS and YouTube extensions.
+func isMediaItem(item *gofeed.Item) bool {
+	if item.ITunesExt != nil {
+		return true
+	}
+	_, media := item.Extensions["media"]
+	_, youtube := item.Extensions["yt"]
+	return media || youtube
+}
+
+// mediaLink is a direct link to the item's audio or video: the first
+// non-image attachment, or the item link for YouTube videos.
+func mediaLink(item *gofeed.Item) string {
+	for _, a := range itemAttachments(item) {
+		if !a.Image {
+			return a.URL
+		}
+	}
+	if _, youtube := item.Extensions["yt"]; youtube {
+		return item.Link
+	}
+	return ""
+}
+
+// mediaMetadataSection renders the duration, episode, explicit flag and media
+// link of podcast and video items. It is empty for other items.
+func mediaMetadataSection(item *gofeed.Item) string {
+	if !isMediaItem(item) {
+		return ""
+	}
+
+	var details []string
+	if itunes := item.ITunesExt; itunes != nil {
+		if itunes.Duration != "" {
+			details = append(details, "Duration: "+formatDuration(itunes.Duration))
+		}
+		switch {
+		case itunes.Season != "" && itunes.Episode != "":
+			details = append(details, fmt.Sprintf("Season %s, episode %s", itunes.Season, itunes.Episode))
+		case itunes.Episode != "":
+			details = append(details, "Episode "+itunes.Episode)
+		case itunes.Season != "":
+			details = append(details, "Season "+itunes.Season)
+		}
+		if itunes.Explicit != "" {
+			explicit := "no"
+			switch strings.ToLower(itunes.Explicit) {
+			case "yes", "true", "explicit":
+				explicit = "yes"
+			}
+			details = append(details, "Explicit: "+explicit)
+		}
+	}
+	if link := mediaLink(item); link != "" {
+		details = append(details, "Media: "+link)
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return "- " + strings.Join(details, "\n- ") + "\n\n"
+}
+
+// formatDuration turns an iTunes duration given in seconds into h:mm:ss.
+// Durations already written as [h:]mm:ss are returned as they are.
+func formatDuration(duration string) string {
+	seconds, err := strconv.Atoi(strings.TrimSpace(duration))
+	if err != nil {
+		return duration
+	}
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// plainTextToHTML escapes a plain text description and keeps its line breaks,
+// so it survives the HTML to Markdown conversion.
+func plainTextToHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>\n")
+}
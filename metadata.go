@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gopkg.in/yaml.v3"
+)
+
+// metadataStart opens the hidden block of provenance metadata added to issue
+// descriptions for feeds with metadata_footer. The block is YAML and ends with
+// the HTML comment.
+const metadataStart = "<!-- gitlabrsssync:meta"
+
+// issueMetadata is where an issue came from, as recorded in its metadata
+// footer. Fields are only ever added, automation depends on them.
+type issueMetadata struct {
+	FeedID    string     `yaml:"feed_id"`
+	FeedURL   string     `yaml:"feed_url"`
+	GUID      string     `yaml:"guid"`
+	Published *time.Time `yaml:"published,omitempty"`
+}
+
+// metadataFooter returns the metadata block for the issue created from item,
+// or an empty string if the feed doesn't have metadata_footer.
+func (feed Feed) metadataFooter(item *gofeed.Item) string {
+	if !feed.MetadataFooter {
+		return ""
+	}
+	metadata := issueMetadata{
+		FeedID:    feed.ID,
+		FeedURL:   redactURL(feed.FeedURL),
+		GUID:      item.GUID,
+		Published: item.PublishedParsed,
+	}
+	if metadata.Published == nil {
+		metadata.Published = item.UpdatedParsed
+	}
+	data, err := yaml.Marshal(metadata)
+	if err != nil {
+		log.Printf("Unable to encode the metadata of '%s' from %s: %v", item.Title, feed.Name, err)
+		return ""
+	}
+	if strings.Contains(string(data), "-->") {
+		// It would end the comment early and show up in the issue
+		debugf("Leaving the metadata footer out of '%s' from %s, it would break the HTML comment", item.Title, feed.Name)
+		return ""
+	}
+	return "\n\n" + metadataStart + "\n" + string(data) + "-->"
+}
+
+// parseMetadataFooter reads the metadata block back out of an issue
+// description, reporting whether there was a valid one.
+func parseMetadataFooter(description string) (issueMetadata, bool) {
+	var metadata issueMetadata
+	start := strings.LastIndex(description, metadataStart+"\n")
+	if start < 0 {
+		return metadata, false
+	}
+	block := description[start+len(metadataStart)+1:]
+	end := strings.Index(block, "-->")
+	if end < 0 {
+		return metadata, false
+	}
+	if err := yaml.Unmarshal([]byte(block[:end]), &metadata); err != nil || metadata.GUID == "" {
+		return metadata, false
+	}
+	return metadata, true
+}
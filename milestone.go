@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// milestoneRef is the milestone a feed's issues are added to. It is shared by
+// every copy of the feed so a refreshed ID sticks.
+type milestoneRef struct {
+	mu sync.Mutex
+	id int
+}
+
+func (m *milestoneRef) get() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.id
+}
+
+func (m *milestoneRef) set(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.id = id
+}
+
+// resolveMilestones checks each feed's milestone exists in its project,
+// resolving titles to IDs.
+func (config *Config) resolveMilestones(gitlabs gitlabInstances) error {
+	for i := range config.Feeds {
+		feed := &config.Feeds[i]
+		if feed.Milestone == "" {
+			continue
+		}
+		id, err := resolveMilestone(gitlabs.forFeed(*feed), feed.GitlabProjectID, feed.Milestone)
+		if err != nil {
+			return fmt.Errorf("feed %s: %w", feed.Name, err)
+		}
+		feed.milestone = &milestoneRef{id: id}
+	}
+	return nil
+}
+
+// resolveMilestone returns the ID of the project milestone given by ID or by
+// title. The error for a missing milestone lists the project's active ones.
+func resolveMilestone(gitlabClient *gitlab.Client, projectID int, milestone string) (int, error) {
+	ctx := gitlab.WithContext(context.Background())
+	if id, err := strconv.Atoi(milestone); err == nil {
+		if _, _, err := gitlabClient.Milestones.GetMilestone(projectID, id, ctx); err == nil {
+			return id, nil
+		}
+	} else {
+		found, _, err := gitlabClient.Milestones.ListMilestones(projectID,
+			&gitlab.ListMilestonesOptions{Title: gitlab.String(milestone), IncludeParentMilestones: gitlab.Ptr(true)}, ctx)
+		if err != nil {
+			return 0, fmt.Errorf("looking up milestone %q: %w", milestone, err)
+		}
+		if len(found) > 0 {
+			return found[0].ID, nil
+		}
+	}
+
+	var available []string
+	opt := &gitlab.ListMilestonesOptions{State: gitlab.String("active"), IncludeParentMilestones: gitlab.Ptr(true)}
+	for {
+		milestones, resp, err := gitlabClient.Milestones.ListMilestones(projectID, opt, ctx)
+		if err != nil {
+			return 0, fmt.Errorf("milestone %q not found in project %d", milestone, projectID)
+		}
+		for _, m := range milestones {
+			available = append(available, fmt.Sprintf("%q (%d)", m.Title, m.ID))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return 0, fmt.Errorf("milestone %q not found in project %d, active milestones are: %s",
+		milestone, projectID, strings.Join(available, ", "))
+}
+
+// refreshMilestone resolves the feed's milestone again, for when Gitlab no
+// longer accepts the ID resolved at startup. It reports whether the ID changed.
+func (feed Feed) refreshMilestone(gitlabClient *gitlab.Client) bool {
+	if feed.milestone == nil {
+		return false
+	}
+	id, err := resolveMilestone(gitlabClient, feed.GitlabProjectID, feed.Milestone)
+	if err != nil {
+		log.Printf("Unable to refresh milestone of feed %s: %v", feed.Name, err)
+		return false
+	}
+	if id == feed.milestone.get() {
+		return false
+	}
+	log.Printf("Milestone %s of feed %s is now ID %d", feed.Milestone, feed.Name, id)
+	feed.milestone.set(id)
+	return true
+}
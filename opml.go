@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"os"
+)
+
+type opmlDocument struct {
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+func (outline opmlOutline) name() string {
+	if outline.Title != "" {
+		return outline.Title
+	}
+	return outline.Text
+}
+
+// opmlFeedID derives a stable feed ID from the feed URL, so re-importing the
+// same subscriptions keeps tracking the same Redis sets.
+func opmlFeedID(feedURL string) string {
+	sum := sha256.Sum256([]byte(feedURL))
+	return "opml_" + hex.EncodeToString(sum[:])[:12]
+}
+
+// readOPML turns every subscription in an OPML file into a Feed targeting
+// projectID. Folders the subscription is nested in are added as labels on top
+// of the default labels.
+func readOPML(path string, projectID int, labels []string) ([]Feed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc opmlDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing OPML: %w", err)
+	}
+
+	var feeds []Feed
+	var walk func(outlines []opmlOutline, labels []string)
+	walk = func(outlines []opmlOutline, labels []string) {
+		for _, outline := range outlines {
+			if outline.XMLURL == "" {
+				// A folder, its children inherit its name as a label
+				folderLabels := append(append([]string{}, labels...), outline.name())
+				walk(outline.Outlines, folderLabels)
+				continue
+			}
+			feeds = append(feeds, Feed{
+				ID:              opmlFeedID(outline.XMLURL),
+				FeedURL:         outline.XMLURL,
+				Name:            outline.name(),
+				GitlabProjectID: projectID,
+				Labels:          append([]string{}, labels...),
+			})
+		}
+	}
+	walk(doc.Outlines, labels)
+
+	return feeds, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// knownFeedsKey is the Redis set of the IDs of every feed that has been
+// configured, so feeds removed from the configuration can be told apart from
+// other data in Redis. Each deployment sharing a Redis has its own, so none
+// takes the feeds of another for orphans.
+func (config *Config) knownFeedsKey() string {
+	if config.Deployment == "" {
+		return "rss_gitlab_sync:feeds"
+	}
+	return "rss_gitlab_sync:" + config.Deployment + ":feeds"
+}
+
+// feedKeySuffixes are appended to a feed's ID for the keys kept alongside its
+// set of GUIDs.
+var feedKeySuffixes = []string{":fetch_state", ":content_hashes", ":issues", ":items", ":synced_at"}
+
+// feedKeys returns every Redis key holding data of the feed.
+func feedKeys(feedID string) []string {
+	keys := []string{feedID}
+	for _, suffix := range feedKeySuffixes {
+		keys = append(keys, feedID+suffix)
+	}
+	return keys
+}
+
+// orphanedFeeds registers the configured feeds in knownFeedsKey and returns
+// the IDs registered there for feeds that are no longer configured. Feeds
+// removed before the registry existed aren't found.
+func (config *Config) orphanedFeeds(ctx context.Context, redisClient *redis.Client) ([]string, error) {
+	configured := make(map[string]bool, len(config.Feeds))
+	members := make([]interface{}, 0, len(config.Feeds))
+	for _, feed := range config.Feeds {
+		configured[feed.ID] = true
+		members = append(members, feed.ID)
+	}
+	if len(members) > 0 {
+		if err := redisClient.SAdd(ctx, config.knownFeedsKey(), members...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	known, err := redisClient.SMembers(ctx, config.knownFeedsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	var orphans []string
+	for _, feedID := range known {
+		if !configured[feedID] {
+			orphans = append(orphans, feedID)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// checkOrphanedFeeds looks for feeds with data in Redis that are no longer
+// configured, warning about them or, with prune, deleting their keys.
+func (config *Config) checkOrphanedFeeds(redisClient *redis.Client, prune bool) error {
+	ctx := context.Background()
+	orphans, err := config.orphanedFeeds(ctx, redisClient)
+	if err != nil {
+		return fmt.Errorf("listing feeds in Redis: %w", err)
+	}
+	for _, feedID := range orphans {
+		count, err := redisClient.SCard(ctx, feedID).Result()
+		if err != nil {
+			return fmt.Errorf("counting items of %s: %w", feedID, err)
+		}
+		if !prune {
+			log.Printf("WARNING: feed %s isn't configured but has %d synced GUIDs in Redis, set prune_orphaned_feeds or run with -prune-orphans to delete them", feedID, count)
+			continue
+		}
+		if err := config.deleteFeed(ctx, redisClient, feedID); err != nil {
+			return fmt.Errorf("deleting %s: %w", feedID, err)
+		}
+		log.Printf("Deleted feed %s from Redis as it isn't configured, with %d synced GUIDs", feedID, count)
+	}
+	return nil
+}
+
+// deleteFeed deletes the keys of the feed and its entry in knownFeedsKey.
+func (config *Config) deleteFeed(ctx context.Context, redisClient *redis.Client, feedID string) error {
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, feedKeys(feedID)...)
+		pipe.SRem(ctx, config.knownFeedsKey(), feedID)
+		return nil
+	})
+	return err
+}
+
+// confirmPrune lists the feeds -prune-orphans would delete on out and asks for
+// confirmation on in, reporting whether to go ahead.
+func (config *Config) confirmPrune(redisClient *redis.Client, in io.Reader, out io.Writer) (bool, error) {
+	orphans, err := config.orphanedFeeds(context.Background(), redisClient)
+	if err != nil {
+		return false, fmt.Errorf("listing feeds in Redis: %w", err)
+	}
+	if len(orphans) == 0 {
+		fmt.Fprintln(out, "No feeds to delete, every feed in Redis is configured")
+		return false, nil
+	}
+	fmt.Fprintf(out, "Delete what Redis holds for these feeds, which aren't configured?\n  %s\n[y/N] ", strings.Join(orphans, "\n  "))
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
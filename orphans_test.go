@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+)
+
+// newTestRedis starts an in-memory Redis for the test.
+func newTestRedis(t testing.TB) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func TestCheckOrphanedFeeds(t *testing.T) {
+	server, client := newTestRedis(t)
+	server.SAdd("kept", "guid-1")
+	server.SAdd("removed", "guid-1", "guid-2")
+	server.HSet("removed:fetch_state", "etag", "abc")
+	server.HSet("removed:issues", "guid-1", "1#1")
+	// Data of something else sharing the Redis
+	server.SAdd("sessions", "x")
+	server.SAdd("unrelated:items", "y")
+
+	before := &Config{Feeds: []Feed{{ID: "kept"}, {ID: "removed"}}}
+	if err := before.checkOrphanedFeeds(client, true); err != nil {
+		t.Fatal(err)
+	}
+	if !server.Exists("removed") {
+		t.Fatal("configured feed was deleted")
+	}
+
+	after := &Config{Feeds: []Feed{{ID: "kept"}}}
+	if err := after.checkOrphanedFeeds(client, false); err != nil {
+		t.Fatal(err)
+	}
+	if !server.Exists("removed") {
+		t.Fatal("orphaned feed was deleted without prune")
+	}
+	if err := after.checkOrphanedFeeds(client, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"removed", "removed:fetch_state", "removed:issues"} {
+		if server.Exists(key) {
+			t.Errorf("%s wasn't deleted", key)
+		}
+	}
+	for _, key := range []string{"kept", "sessions", "unrelated:items"} {
+		if !server.Exists(key) {
+			t.Errorf("%s was deleted", key)
+		}
+	}
+	if ok, _ := server.SIsMember(after.knownFeedsKey(), "removed"); ok {
+		t.Error("deleted feed is still registered")
+	}
+}
+
+func TestOrphanedFeedsOfSharedRedis(t *testing.T) {
+	server, client := newTestRedis(t)
+	server.SAdd("security", "guid-1")
+	server.SAdd("releases", "guid-1")
+	security := &Config{Deployment: "security", Feeds: []Feed{{ID: "security"}}}
+	releases := &Config{Deployment: "releases", Feeds: []Feed{{ID: "releases"}}}
+
+	for _, config := range []*Config{security, releases, security} {
+		if err := config.checkOrphanedFeeds(client, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{"security", "releases"} {
+		if !server.Exists(key) {
+			t.Errorf("%s was deleted by the other deployment", key)
+		}
+	}
+}
+
+func TestConfirmPrune(t *testing.T) {
+	_, client := newTestRedis(t)
+	ctx := context.Background()
+	config := &Config{Feeds: []Feed{{ID: "kept"}}}
+	client.SAdd(ctx, config.knownFeedsKey(), "old")
+
+	for answer, want := range map[string]bool{"y\n": true, "yes\n": true, "n\n": false, "": false} {
+		var out bytes.Buffer
+		confirmed, err := config.confirmPrune(client, strings.NewReader(answer), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if confirmed != want {
+			t.Errorf("answer %q confirmed %v, want %v", answer, confirmed, want)
+		}
+		if !strings.Contains(out.String(), "old") {
+			t.Errorf("prompt doesn't list the orphaned feed: %q", out.String())
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// unavailableAfter is how many Gitlab requests in a row have to fail with a
+// 502/503 or a refused connection before the instance is taken to be down.
+const unavailableAfter = 3
+
+// defaultUnavailableBackoff is how long checks of feeds syncing to an
+// unavailable instance are paused when unavailable_backoff isn't configured.
+const defaultUnavailableBackoff = 2 * time.Minute
+
+// gitlabAvailability tracks which Gitlab instances look to be down, for
+// example in a maintenance window.
+var gitlabAvailability *availability
+
+type availability struct {
+	mu          sync.Mutex
+	backoff     time.Duration
+	failures    map[string]int
+	pausedUntil map[string]time.Time
+}
+
+// newAvailability starts out with every instance available.
+func newAvailability(gitlabs gitlabInstances, backoff time.Duration) *availability {
+	for baseURL := range gitlabs {
+		gitlabAvailableGauge.WithLabelValues(baseURL).Set(1)
+	}
+	return &availability{
+		backoff:     backoff,
+		failures:    make(map[string]int),
+		pausedUntil: make(map[string]time.Time),
+	}
+}
+
+// record takes note of the outcome of a Gitlab request and reports whether
+// the instance is unavailable, in which case the caller stops making requests
+// to it. Checks of its feeds are then paused for the backoff.
+func (a *availability) record(baseURL string, err error) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if until, down := a.pausedUntil[baseURL]; down && time.Now().Before(until) {
+		return true
+	}
+	if !isGitlabUnavailable(err) {
+		a.failures[baseURL] = 0
+		if _, down := a.pausedUntil[baseURL]; down {
+			log.Printf("GitLab %s is available again", baseURL)
+			delete(a.pausedUntil, baseURL)
+			gitlabAvailableGauge.WithLabelValues(baseURL).Set(1)
+		}
+		return false
+	}
+
+	a.failures[baseURL]++
+	if a.failures[baseURL] < unavailableAfter {
+		return false
+	}
+	a.failures[baseURL] = 0
+	a.pausedUntil[baseURL] = time.Now().Add(a.backoff)
+	gitlabAvailableGauge.WithLabelValues(baseURL).Set(0)
+	log.Printf("GitLab %s appears unavailable, pausing for %s: %v", baseURL, a.backoff, err)
+	return true
+}
+
+// paused reports whether checks of feeds syncing to the instance are paused,
+// and until when.
+func (a *availability) paused(baseURL string) (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	until, down := a.pausedUntil[baseURL]
+	return until, down && time.Now().Before(until)
+}
+
+// isGitlabUnavailable reports whether a request failed because Gitlab is down
+// rather than because of the request: a 502 or 503 from it, or its proxy, or a
+// refused connection.
+func isGitlabUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var errResp *gitlab.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		status := errResp.Response.StatusCode
+		return status == http.StatusBadGateway || status == http.StatusServiceUnavailable
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
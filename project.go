@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// resolveProjects sets the project ID of feeds giving their project as a
+// gitlab_project path, creating the project in gitlab_namespace_id when it
+// doesn't exist and the feed has create_project_if_missing.
+func (config *Config) resolveProjects(gitlabs gitlabInstances) error {
+	ids := make(map[string]int)
+	for i := range config.Feeds {
+		feed := &config.Feeds[i]
+		if feed.GitlabProject == "" {
+			continue
+		}
+		// Paths are per instance
+		key := feed.GitlabBaseURL + " " + feed.GitlabProject
+		if id, ok := ids[key]; ok {
+			feed.GitlabProjectID = id
+			continue
+		}
+		gitlabClient := gitlabs.forFeed(*feed)
+		project, resp, err := gitlabClient.Projects.GetProject(feed.GitlabProject, nil, gitlab.WithContext(context.Background()))
+		if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound && feed.CreateProjectIfMissing {
+			project, err = feed.createProject(gitlabClient)
+		}
+		if err != nil {
+			return fmt.Errorf("project %s of feed %s: %w", feed.GitlabProject, feed.Name, err)
+		}
+		feed.GitlabProjectID = project.ID
+		ids[key] = project.ID
+	}
+	return nil
+}
+
+// createProject creates the feed's gitlab_project in its gitlab_namespace_id,
+// private and with issues enabled.
+func (feed Feed) createProject(gitlabClient *gitlab.Client) (*gitlab.Project, error) {
+	name := path.Base(feed.GitlabProject)
+	options := &gitlab.CreateProjectOptions{
+		Name:              gitlab.String(name),
+		Path:              gitlab.String(name),
+		NamespaceID:       gitlab.Ptr(feed.GitlabNamespaceID),
+		Description:       gitlab.String("Issues synced from the " + feed.Name + " feed"),
+		IssuesAccessLevel: gitlab.Ptr(gitlab.EnabledAccessControl),
+		Visibility:        gitlab.Ptr(gitlab.PrivateVisibility),
+	}
+	project, _, err := gitlabClient.Projects.CreateProject(options, gitlab.WithContext(context.Background()))
+	if err != nil {
+		return nil, fmt.Errorf("creating project: %w", err)
+	}
+	log.Printf("Created Gitlab project %s (ID %d) for feed %s, as it didn't exist", project.PathWithNamespace, project.ID, feed.Name)
+	return project, nil
+}
+
+// validateProjects checks every project feeds create issues in can be used
+// with the token: that it exists and can be read, isn't archived, and that the
+// token has at least Reporter access to create issues. It logs a table of each
+// feed's project and access level and returns the problems found.
+func (config *Config) validateProjects(gitlabs gitlabInstances) error {
+	type projectKey struct {
+		baseURL string
+		id      int
+	}
+	var problems []error
+	checked := make(map[projectKey]string)
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FEED\tPROJECT\tACCESS")
+	for _, feed := range config.Feeds {
+		if feed.targetsEpics() || !feed.isEnabled() {
+			continue
+		}
+		key := projectKey{feed.GitlabBaseURL, feed.GitlabProjectID}
+		row, ok := checked[key]
+		if !ok {
+			var err error
+			row, err = checkProject(gitlabs.forFeed(feed), feed.GitlabProjectID)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("project %d of feed %s: %w", feed.GitlabProjectID, feed.Name, err))
+			}
+			checked[key] = row
+		}
+		fmt.Fprintf(w, "%s\t%s\n", feed.Name, row)
+	}
+	w.Flush()
+	log.Printf("Gitlab projects:\n%s", table.String())
+	return errors.Join(problems...)
+}
+
+// checkProject describes a project and the token's access to it for the
+// validateProjects table, with an error if issues can't be created in it.
+func checkProject(gitlabClient *gitlab.Client, projectID int) (string, error) {
+	project, _, err := gitlabClient.Projects.GetProject(projectID, nil, gitlab.WithContext(context.Background()))
+	if err != nil {
+		return fmt.Sprintf("%d\tunavailable", projectID), err
+	}
+	row := project.PathWithNamespace + "\t"
+	if project.Archived {
+		return row + "archived", errors.New("project is archived")
+	}
+	access := projectAccessLevel(project)
+	if access == gitlab.NoPermissions {
+		// Admins and job tokens don't get permissions back, creating issues
+		// is the only way to find out
+		return row + "unknown", nil
+	}
+	row += accessLevelName(access)
+	if access < gitlab.ReporterPermissions {
+		return row, fmt.Errorf("access level %s can't create issues", accessLevelName(access))
+	}
+	return row, nil
+}
+
+// projectAccessLevel is the highest of the token's project and group access.
+func projectAccessLevel(project *gitlab.Project) gitlab.AccessLevelValue {
+	access := gitlab.NoPermissions
+	if project.Permissions == nil {
+		return access
+	}
+	if project.Permissions.ProjectAccess != nil {
+		access = max(access, project.Permissions.ProjectAccess.AccessLevel)
+	}
+	if project.Permissions.GroupAccess != nil {
+		access = max(access, project.Permissions.GroupAccess.AccessLevel)
+	}
+	return access
+}
+
+func accessLevelName(access gitlab.AccessLevelValue) string {
+	switch {
+	case access >= gitlab.OwnerPermissions:
+		return "owner"
+	case access >= gitlab.MaintainerPermissions:
+		return "maintainer"
+	case access >= gitlab.DeveloperPermissions:
+		return "developer"
+	case access >= gitlab.ReporterPermissions:
+		return "reporter"
+	case access >= gitlab.GuestPermissions:
+		return "guest"
+	}
+	return "minimal"
+}
+
+// warnConfidentialPublic warns about confidential feeds syncing to public
+// projects, where the issues' existence is still visible to everyone.
+func (config *Config) warnConfidentialPublic(gitlabs gitlabInstances) {
+	for _, feed := range config.Feeds {
+		if !feed.Confidential || feed.targetsEpics() {
+			continue
+		}
+		project, _, err := gitlabs.forFeed(feed).Projects.GetProject(feed.GitlabProjectID, nil, gitlab.WithContext(context.Background()))
+		if err != nil {
+			log.Printf("Unable to check visibility of project %d for confidential feed %s: %v", feed.GitlabProjectID, feed.Name, err)
+			continue
+		}
+		if project.Visibility == gitlab.PublicVisibility {
+			log.Printf("WARNING: confidential feed %s creates issues in public project %s", feed.Name, project.PathWithNamespace)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// permanentRedirectTarget follows the redirects that led to resp and returns
+// the URL reached through permanent redirects (301 and 308) from the original
+// request, or an empty string if the first hop wasn't permanent.
+func permanentRedirectTarget(resp *http.Response) string {
+	// Each redirected request links back to the response that caused it, so
+	// walk back to the original request
+	var chain []*http.Request
+	for req := resp.Request; req != nil; {
+		chain = append([]*http.Request{req}, chain...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+
+	target := ""
+	for _, req := range chain[1:] {
+		if status := req.Response.StatusCode; status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			break
+		}
+		target = req.URL.String()
+	}
+	return target
+}
+
+// noteRedirect records a permanent redirect of sourceURL, logging it the first
+// time it is seen so a moved feed doesn't go unnoticed. resp may come from a
+// previously recorded redirect target rather than sourceURL itself.
+func (feed Feed) noteRedirect(ctx context.Context, redisClient *redis.Client, state map[string]string, sourceURL string, resp *http.Response) {
+	target := permanentRedirectTarget(resp)
+	if target == "" {
+		return
+	}
+	feedRedirectedGauge.WithLabelValues(feed.Name, redactURL(target)).Set(1)
+	if state["redirect_from"] == sourceURL && state["redirect_to"] == target {
+		return
+	}
+
+	log.Printf("Feed %s has permanently moved from %s to %s, consider updating feed_url", feed.Name, redactURL(sourceURL), redactURL(target))
+	err := redisClient.HSet(ctx, fetchStateKey(feed.ID), "redirect_from", sourceURL, "redirect_to", target).Err()
+	if err != nil {
+		log.Printf("Unable to persist redirect for feed %s in Redis: %v", feed.Name, err)
+	}
+}
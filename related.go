@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// relatedIssue finds the issue of an item synced earlier that a new item
+// refers to, by that item's GUID (often its link) appearing in the new item's
+// link or content, as with follow-ups on mailing lists and incident updates.
+// The longest matching GUID wins. An issue that has since been deleted is
+// ignored. refs are the feed's issue references, as read by issueRefs.
+func (feed Feed) relatedIssue(gitlabClient *gitlab.Client, refs map[string]string, item *gofeed.Item) *gitlab.Issue {
+	ctx := context.Background()
+	text := item.Link + "\n" + item.Description + "\n" + item.Content
+	var related string
+	for guid := range refs {
+		if guid != item.GUID && len(guid) > len(related) && containsReference(text, guid) {
+			related = guid
+		}
+	}
+	if related == "" {
+		return nil
+	}
+
+	ref, err := parseIssueRef(refs[related])
+	if err != nil {
+		log.Printf("Unable to read issue reference of %s in feed %s: %v", related, feed.Name, err)
+		return nil
+	}
+	if ref.ProjectID == 0 {
+		ref.ProjectID = feed.GitlabProjectID
+	}
+	issue, resp, err := gitlabClient.Issues.GetIssue(ref.ProjectID, ref.IID, gitlab.WithContext(ctx))
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		debugf("Not linking '%s' to issue #%d in project %d, it was deleted", item.Title, ref.IID, ref.ProjectID)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Unable to look up issue #%d in project %d related to '%s': %v", ref.IID, ref.ProjectID, item.Title, err)
+		return nil
+	}
+	return issue
+}
+
+// containsReference reports whether guid appears in text as a whole, not
+// inside a longer word or number.
+func containsReference(text, guid string) bool {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], guid)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(guid)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// relatedLine points the new issue's description at the related issue.
+func (feed Feed) relatedLine(related *gitlab.Issue) string {
+	reference := fmt.Sprintf("#%d", related.IID)
+	if related.ProjectID != feed.GitlabProjectID && related.References != nil {
+		reference = related.References.Full
+	}
+	return "Related to " + reference
+}
+
+// linkRelated links a new issue to the issue of the item it follows up on. A
+// failure is only logged, the description already mentions it.
+func (feed Feed) linkRelated(gitlabClient *gitlab.Client, issue, related *gitlab.Issue) {
+	options := &gitlab.CreateIssueLinkOptions{
+		TargetProjectID: gitlab.String(strconv.Itoa(related.ProjectID)),
+		TargetIssueIID:  gitlab.String(strconv.Itoa(related.IID)),
+	}
+	if _, _, err := gitlabClient.IssueLinks.CreateIssueLink(feed.GitlabProjectID, issue.IID, options, gitlab.WithContext(context.Background())); err != nil {
+		log.Printf("Unable to link issue #%d to related issue %s: %v", issue.IID, related.WebURL, err)
+	}
+}
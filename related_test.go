@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+func TestContainsReference(t *testing.T) {
+	tests := []struct {
+		text, guid string
+		want       bool
+	}{
+		{"See https://example.com/post/1 for details", "https://example.com/post/1", true},
+		{"See https://example.com/post/12", "https://example.com/post/1", false},
+		{"Incident 42 update", "42", true},
+		{"Incident 420 update", "42", false},
+		{"x42 and 42.", "42", true},
+		{"nothing here", "42", false},
+	}
+	for _, test := range tests {
+		if got := containsReference(test.text, test.guid); got != test.want {
+			t.Errorf("containsReference(%q, %q) = %v, want %v", test.text, test.guid, got, test.want)
+		}
+	}
+}
+
+func TestRelatedIssue(t *testing.T) {
+	var requested []string
+	client := newTestGitlab(t, func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path == "/api/v4/projects/1/issues/9" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"id": 100, "iid": 7, "project_id": 1, "web_url": "https://gitlab.example.com/issues/7"}`)
+	})
+	feed := Feed{ID: "feed", Name: "feed", GitlabProjectID: 1}
+	refs := map[string]string{
+		"https://example.com/thread":        "1#3",
+		"https://example.com/thread/update": "1#7",
+		"https://example.com/deleted":       "1#9",
+	}
+
+	item := &gofeed.Item{GUID: "new", Link: "https://example.com/other", Content: "Follows up https://example.com/thread/update"}
+	related := feed.relatedIssue(client, refs, item)
+	if related == nil || related.IID != 7 {
+		t.Fatalf("relatedIssue = %+v, want the issue of the longest matching GUID", related)
+	}
+	if len(requested) != 1 || requested[0] != "/api/v4/projects/1/issues/7" {
+		t.Errorf("requested %v", requested)
+	}
+
+	if got := feed.relatedIssue(client, refs, &gofeed.Item{GUID: "https://example.com/thread", Link: "https://example.com/thread"}); got != nil {
+		t.Errorf("item is related to its own issue %+v", got)
+	}
+	if got := feed.relatedIssue(client, refs, &gofeed.Item{GUID: "new", Description: "see https://example.com/deleted"}); got != nil {
+		t.Errorf("item is related to deleted issue %+v", got)
+	}
+	if got := feed.relatedIssue(client, map[string]string{}, item); got != nil {
+		t.Errorf("item is related to %+v without any references", got)
+	}
+}
+
+func TestRelatedLine(t *testing.T) {
+	feed := Feed{GitlabProjectID: 1}
+	if got := feed.relatedLine(&gitlab.Issue{IID: 7, ProjectID: 1}); got != "Related to #7" {
+		t.Errorf("same project: %q", got)
+	}
+	other := &gitlab.Issue{IID: 7, ProjectID: 2, References: &gitlab.IssueReferences{Full: "group/other#7"}}
+	if got := feed.relatedLine(other); got != "Related to group/other#7" {
+		t.Errorf("other project: %q", got)
+	}
+}
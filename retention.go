@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/mmcdole/gofeed"
+)
+
+// retentionPassInterval is how often a feed's synced GUIDs are checked
+// against its retention.
+const retentionPassInterval = 24 * time.Hour
+
+// syncedAtKey is the Redis hash mapping each GUID of a feed to when it was
+// recorded as synced, in Unix seconds.
+func syncedAtKey(feedID string) string {
+	return feedID + ":synced_at"
+}
+
+// pruneItems forgets the feed's GUIDs recorded longer than its retention ago,
+// at most once a day. GUIDs of items still in the feed document are kept
+// whatever their age, forgetting them would sync them again. GUIDs recorded
+// before synced_at was kept are given the current time.
+func (feed Feed) pruneItems(redisClient *redis.Client, items []*gofeed.Item) {
+	if feed.Retention <= 0 || feed.isDryRun() {
+		return
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	last, err := redisClient.HGet(ctx, fetchStateKey(feed.ID), "pruned_at").Int64()
+	if err != nil && err != redis.Nil {
+		log.Printf("Unable to read the last retention pass of feed %s from Redis: %v", feed.Name, err)
+		return
+	}
+	if now.Sub(time.Unix(last, 0)) < retentionPassInterval {
+		return
+	}
+
+	listed := make(map[string]bool, len(items))
+	for _, item := range items {
+		listed[item.GUID] = true
+	}
+	cutoff := now.Add(-feed.Retention)
+	removed := 0
+	var cursor uint64
+	for {
+		guids, next, err := syncedItems(ctx, redisClient, feed.ID, cursor, maxItemsPageSize)
+		if err != nil {
+			log.Printf("Unable to list the items of feed %s in Redis: %v", feed.Name, err)
+			return
+		}
+		syncedAt, err := syncedTimes(ctx, redisClient, feed.ID, guids)
+		if err != nil {
+			log.Printf("Unable to read when items of feed %s were synced from Redis: %v", feed.Name, err)
+			return
+		}
+		for i, guid := range guids {
+			if listed[guid] {
+				continue
+			}
+			if syncedAt[i].IsZero() {
+				if err := redisClient.HSetNX(ctx, syncedAtKey(feed.ID), guid, now.Unix()).Err(); err != nil {
+					log.Printf("Unable to persist when %s was synced in Redis: %v", guid, err)
+				}
+				continue
+			}
+			if !syncedAt[i].Before(cutoff) {
+				continue
+			}
+			if _, err := forgetItem(ctx, redisClient, feed.ID, guid); err != nil {
+				log.Printf("Unable to forget %s of feed %s in Redis: %v", guid, feed.Name, err)
+				continue
+			}
+			removed++
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+
+	if err := redisClient.HSet(ctx, fetchStateKey(feed.ID), "pruned_at", now.Unix()).Err(); err != nil {
+		log.Printf("Unable to persist the retention pass of feed %s in Redis: %v", feed.Name, err)
+	}
+	log.Printf("Removed %d GUIDs synced more than %s ago and no longer in %s", removed, feed.Retention, feed.Name)
+}
+
+// syncedTimes looks up when each of the GUIDs was recorded as synced, the
+// zero time for those without a record.
+func syncedTimes(ctx context.Context, redisClient *redis.Client, feedID string, guids []string) ([]time.Time, error) {
+	times := make([]time.Time, len(guids))
+	if len(guids) == 0 {
+		return times, nil
+	}
+	values, err := redisClient.HMGet(ctx, syncedAtKey(feedID), guids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if text, ok := value.(string); ok {
+			if unix, err := strconv.ParseInt(text, 10, 64); err == nil {
+				times[i] = time.Unix(unix, 0)
+			}
+		}
+	}
+	return times, nil
+}
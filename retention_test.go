@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestPruneItems(t *testing.T) {
+	server, client := newTestRedis(t)
+	ctx := context.Background()
+	feed := Feed{ID: "feed", Name: "feed", Retention: 30 * 24 * time.Hour}
+	old := strconv.FormatInt(time.Now().Add(-60*24*time.Hour).Unix(), 10)
+	recent := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	for guid, syncedAt := range map[string]string{"old-listed": old, "old-gone": old, "recent-gone": recent, "legacy-gone": ""} {
+		server.SAdd(feed.ID, guid)
+		if syncedAt != "" {
+			server.HSet(syncedAtKey(feed.ID), guid, syncedAt)
+		}
+	}
+	server.HSet(issuesKey(feed.ID), "old-gone", "1#2")
+	listed := []*gofeed.Item{{GUID: "old-listed"}}
+
+	feed.pruneItems(client, listed)
+
+	for guid, kept := range map[string]bool{"old-listed": true, "old-gone": false, "recent-gone": true, "legacy-gone": true} {
+		if found, _ := client.SIsMember(ctx, feed.ID, guid).Result(); found != kept {
+			t.Errorf("%s kept: %v, want %v", guid, found, kept)
+		}
+	}
+	if server.HGet(issuesKey(feed.ID), "old-gone") != "" {
+		t.Error("issue reference of a pruned GUID was kept")
+	}
+	if server.HGet(syncedAtKey(feed.ID), "legacy-gone") == "" {
+		t.Error("GUID recorded before synced_at wasn't given a time")
+	}
+
+	// Only one pass a day
+	server.SAdd(feed.ID, "old-again")
+	server.HSet(syncedAtKey(feed.ID), "old-again", old)
+	feed.pruneItems(client, listed)
+	if found, _ := client.SIsMember(ctx, feed.ID, "old-again").Result(); !found {
+		t.Error("a second pass ran the same day")
+	}
+
+	// Disabled by default
+	server.FlushAll()
+	server.SAdd(feed.ID, "old-gone")
+	server.HSet(syncedAtKey(feed.ID), "old-gone", old)
+	(Feed{ID: "feed", Name: "feed"}).pruneItems(client, nil)
+	if found, _ := client.SIsMember(ctx, feed.ID, "old-gone").Result(); !found {
+		t.Error("GUID pruned without a retention")
+	}
+}
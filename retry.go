@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// gitlabAttempts is how many times a Gitlab API request is tried before its
+// error is reported.
+const gitlabAttempts = 3
+
+// maxRateLimitWait bounds how long a request rate limited by Gitlab waits
+// before it is retried, whatever the server asks for.
+const maxRateLimitWait = 5 * time.Minute
+
+// gitlabBackoff is how long the Gitlab client waits before retrying a request.
+// Rate limited requests wait as long as Gitlab asks them to, others back off
+// exponentially with jitter.
+func gitlabBackoff(waitMin, waitMax time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		wait := rateLimitWait(resp, waitMin, attemptNum)
+		gitlabRateLimitedCounter.Inc()
+		log.Printf("Rate limited by Gitlab, backing off for %s before retrying %s", wait.Round(time.Millisecond), resp.Request.URL.Path)
+		return wait
+	}
+	wait := time.Second << min(attemptNum, 6)
+	wait += rand.N(wait / 2)
+	if resp != nil {
+		log.Printf("Gitlab answered %s, retrying %s in %s", resp.Status, resp.Request.URL.Path, wait.Round(time.Millisecond))
+	} else {
+		log.Printf("Gitlab request failed, retrying in %s", wait.Round(time.Millisecond))
+	}
+	return wait
+}
+
+// creatingKey marks the context of requests creating an issue or epic, see
+// creating.
+type creatingKey struct{}
+
+// creating marks requests made with the context as creating something, so
+// they are only retried when Gitlab certainly didn't act on them: when rate
+// limited or the connection was refused. After a timeout or a server error the
+// issue may exist, retrying could create it twice. The item is left for the
+// next run instead, whose duplicate check finds it by its marker.
+func creating(ctx context.Context) context.Context {
+	return context.WithValue(ctx, creatingKey{}, true)
+}
+
+// gitlabCheckRetry decides whether a Gitlab API request is retried: on network
+// errors, rate limiting and server errors, but not other 4xx responses which
+// would only fail again.
+func gitlabCheckRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if isCreating, _ := ctx.Value(creatingKey{}).(bool); isCreating {
+		if err != nil {
+			return errors.Is(err, syscall.ECONNREFUSED), nil
+		}
+		return resp.StatusCode == http.StatusTooManyRequests, nil
+	}
+	if err != nil {
+		return true, nil
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, nil
+}
+
+// gitlabClientOptions are the options every Gitlab client is created with.
+func gitlabClientOptions(baseURL string) []gitlab.ClientOptionFunc {
+	return []gitlab.ClientOptionFunc{
+		gitlab.WithBaseURL(baseURL),
+		gitlab.WithCustomRetry(gitlabCheckRetry),
+		gitlab.WithCustomBackoff(gitlabBackoff),
+		gitlab.WithCustomRetryMax(gitlabAttempts - 1),
+	}
+}
+
+// rateLimitWait reads the wait from a 429 response's Retry-After header, in
+// seconds or as a date, or its RateLimit-Reset timestamp. Without either it
+// backs off exponentially from waitMin. The wait is capped at maxRateLimitWait.
+func rateLimitWait(resp *http.Response, waitMin time.Duration, attemptNum int) time.Duration {
+	wait := waitMin * time.Duration(1<<min(attemptNum, 10))
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(retryAfter); err == nil {
+			wait = time.Until(at)
+		}
+	} else if reset := resp.Header.Get("RateLimit-Reset"); reset != "" {
+		if unix, err := strconv.ParseInt(reset, 10, 64); err == nil {
+			wait = time.Until(time.Unix(unix, 0))
+		}
+	}
+	return min(max(wait, waitMin), maxRateLimitWait)
+}
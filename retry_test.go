@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// newTestGitlab starts a Gitlab API answering with handler and returns a
+// client for it created with gitlabClientOptions.
+func newTestGitlab(t *testing.T, handler http.HandlerFunc) *gitlab.Client {
+	t.Helper()
+	gitlabRateLimitedCounter = prometheus.NewCounter(prometheus.CounterOpts{Name: "test_gitlab_rate_limited_total"})
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := gitlab.NewClient("token", gitlabClientOptions(server.URL+"/api/v4")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestCreateIssueRetriedWhenRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestGitlab(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 70, "iid": 7}`))
+	})
+
+	feed := Feed{GitlabProjectID: 1}
+	issue, err := feed.createIssue(client, nil, &gitlab.CreateIssueOptions{Title: gitlab.Ptr("Title")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issue.IID != 7 || requests.Load() != 2 {
+		t.Errorf("got issue %d after %d requests, want 7 after 2", issue.IID, requests.Load())
+	}
+	if got := testutil.ToFloat64(gitlabRateLimitedCounter); got != 1 {
+		t.Errorf("gitlab_rate_limited_total = %v, want 1", got)
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"retry after seconds", http.Header{"Retry-After": {"30"}}, 30 * time.Second},
+		{"retry after date", http.Header{"Retry-After": {now.Add(time.Minute).UTC().Format(http.TimeFormat)}}, time.Minute},
+		{"rate limit reset", http.Header{"Ratelimit-Reset": {strconv.FormatInt(now.Add(2*time.Minute).Unix(), 10)}}, 2 * time.Minute},
+		{"capped", http.Header{"Retry-After": {"3600"}}, maxRateLimitWait},
+		{"no header", http.Header{}, 4 * time.Second},
+		{"in the past", http.Header{"Retry-After": {"-5"}}, time.Second},
+	}
+	for _, test := range tests {
+		got := rateLimitWait(&http.Response{Header: test.header}, time.Second, 2)
+		if got > test.want || got < test.want-2*time.Second {
+			t.Errorf("%s: waited %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCreateIssueNotRetriedAfterServerError(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestGitlab(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	feed := Feed{GitlabProjectID: 1}
+	if _, err := feed.createIssue(client, nil, &gitlab.CreateIssueOptions{Title: gitlab.Ptr("Title")}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("create was sent %d times, a server error may have created the issue", requests.Load())
+	}
+}
+
+func TestReadRetriedAfterServerError(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestGitlab(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"version": "17.0.0"}`))
+	})
+
+	version, _, err := client.Version.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Version != "17.0.0" || requests.Load() != 2 {
+		t.Errorf("got version %q after %d requests", version.Version, requests.Load())
+	}
+}
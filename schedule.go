@@ -0,0 +1,196 @@
+package main
+
+import (
+	"container/heap"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+type scheduledFeed struct {
+	feed Feed
+	at   time.Time
+}
+
+// feedQueue is a min-heap of feeds ordered by when they are next due.
+type feedQueue []scheduledFeed
+
+func (q feedQueue) Len() int           { return len(q) }
+func (q feedQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q feedQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *feedQueue) Push(x any)        { *q = append(*q, x.(scheduledFeed)) }
+func (q *feedQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// runScheduler checks every enabled feed whenever it is due, up to
+// config.Concurrency feeds at a time. A feed is never checked concurrently with
+// itself: its next run is scheduled once its current check has finished, or
+// when the pause ends if its Gitlab instance is unavailable.
+func runScheduler(config *Config, redisClient *redis.Client, gitlabs gitlabInstances) {
+	issueCreationBudget = newIssueBudget(config.MaxIssuesPerRun, config.interval())
+
+	work := make(chan Feed)
+	done := make(chan Feed)
+	for i := 0; i < config.Concurrency; i++ {
+		go func() {
+			for feed := range work {
+				feed.checkFeed(redisClient, gitlabs.forFeed(feed))
+				lastRunGauge.SetToCurrentTime()
+				done <- feed
+			}
+		}()
+	}
+
+	// Disabled feeds stay in the queue, outside the stagger, so their skip is
+	// logged every time they would have been due
+	queue := &feedQueue{}
+	var enabled []Feed
+	for _, configEntry := range config.Feeds {
+		if !configEntry.isEnabled() {
+			feedEnabledGauge.WithLabelValues(configEntry.Name).Set(0)
+			heap.Push(queue, scheduledFeed{feed: configEntry, at: time.Now()})
+			continue
+		}
+		feedEnabledGauge.WithLabelValues(configEntry.Name).Set(1)
+		enabled = append(enabled, configEntry)
+	}
+	for _, scheduled := range config.schedule(enabled, time.Now()) {
+		heap.Push(queue, scheduled)
+	}
+
+	reschedule := func(feed Feed) {
+		scheduled := scheduledFeed{feed: feed, at: feed.nextRun(config, time.Now())}
+		if until, paused := gitlabAvailability.paused(feed.GitlabBaseURL); paused && until.Before(scheduled.at) {
+			// Retry once the pause is over rather than a whole interval later
+			scheduled.at = until
+		}
+		heap.Push(queue, scheduled)
+		recordNextRun(feed, scheduled.at)
+	}
+
+	for {
+		var due <-chan time.Time
+		if queue.Len() > 0 {
+			due = time.After(time.Until((*queue)[0].at))
+		}
+
+		select {
+		case feed := <-done:
+			recordChecked(feed, time.Now())
+			reschedule(feed)
+		case <-due:
+			scheduled := heap.Pop(queue).(scheduledFeed)
+			if !scheduled.feed.isEnabled() {
+				log.Printf("Feed %s is disabled, skipping", scheduled.feed.Name)
+				heap.Push(queue, scheduledFeed{feed: scheduled.feed, at: scheduled.feed.nextRun(config, time.Now())})
+				continue
+			}
+			log.Printf("Running check of %s at %s", scheduled.feed.Name, time.Now().Format(time.RFC850))
+			// Keep taking completions while waiting for a free worker, they
+			// would otherwise block on done forever
+			for sent := false; !sent; {
+				select {
+				case work <- scheduled.feed:
+					sent = true
+				case feed := <-done:
+					recordChecked(feed, time.Now())
+					reschedule(feed)
+				}
+			}
+		}
+	}
+}
+
+// runOnce checks every enabled feed once, up to config.Concurrency at a time,
+// and returns when they are all done.
+func runOnce(config *Config, redisClient *redis.Client, gitlabs gitlabInstances) {
+	issueCreationBudget = newIssueBudget(config.MaxIssuesPerRun, config.interval())
+
+	work := make(chan Feed)
+	var wg sync.WaitGroup
+	for i := 0; i < config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for feed := range work {
+				feed.checkFeed(redisClient, gitlabs.forFeed(feed))
+				lastRunGauge.SetToCurrentTime()
+			}
+		}()
+	}
+	for _, feed := range config.Feeds {
+		if !feed.isEnabled() {
+			log.Printf("Feed %s is disabled, skipping", feed.Name)
+			feedEnabledGauge.WithLabelValues(feed.Name).Set(0)
+			continue
+		}
+		feedEnabledGauge.WithLabelValues(feed.Name).Set(1)
+		work <- feed
+	}
+	close(work)
+	wg.Wait()
+}
+
+// nextRun is when the feed is next due after a check that finished at
+// finished: the next time matching its cron schedule, or its interval (the
+// global one unless overridden) later.
+func (feed Feed) nextRun(config *Config, finished time.Time) time.Time {
+	if feed.cronSchedule != nil {
+		return feed.cronSchedule.Next(finished)
+	}
+	return finished.Add(feed.interval(config))
+}
+
+// interval is the time between checks of a feed without a cron schedule.
+func (feed Feed) interval(config *Config) time.Duration {
+	if feed.Interval > 0 {
+		return feed.Interval
+	}
+	return config.interval()
+}
+
+// schedule works out the first run of each feed after start. Feeds with a cron
+// schedule run at its next match. The others are spread over the interval:
+// each is Stagger after the previous one plus a random Jitter, both capped so
+// every check starts within the interval.
+func (config *Config) schedule(feeds []Feed, start time.Time) []scheduledFeed {
+	var schedule []scheduledFeed
+	var spread []Feed
+	for _, feed := range feeds {
+		if feed.cronSchedule != nil {
+			schedule = append(schedule, scheduledFeed{feed: feed, at: feed.cronSchedule.Next(start)})
+		} else {
+			spread = append(spread, feed)
+		}
+	}
+
+	interval := config.interval()
+	stagger, jitter := config.Stagger, config.Jitter
+	if len(spread) > 1 && stagger*time.Duration(len(spread)-1) >= interval {
+		stagger = interval / time.Duration(len(spread))
+		log.Printf("Stagger of %s would overrun the %s interval, using %s", config.Stagger, interval, stagger)
+	}
+	if offset := stagger * time.Duration(max(len(spread)-1, 0)); jitter > 0 && offset+jitter >= interval {
+		jitter = interval - offset - time.Second
+	}
+
+	for i, feed := range spread {
+		at := start.Add(stagger * time.Duration(i))
+		if jitter > 0 {
+			at = at.Add(rand.N(jitter))
+		}
+		schedule = append(schedule, scheduledFeed{feed: feed, at: at})
+	}
+
+	for _, scheduled := range schedule {
+		recordNextRun(scheduled.feed, scheduled.at)
+	}
+	return schedule
+}
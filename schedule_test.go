@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestScheduleStagger(t *testing.T) {
+	config := &Config{Interval: 3600, Stagger: 30 * time.Minute}
+	feeds := []Feed{{ID: "a", Name: "a"}, {ID: "b", Name: "b"}, {ID: "c", Name: "c"}, {ID: "d", Name: "d"}}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	schedule := config.schedule(feeds, start)
+	if len(schedule) != len(feeds) {
+		t.Fatalf("scheduled %d feeds, want %d", len(schedule), len(feeds))
+	}
+	for i, scheduled := range schedule {
+		// A stagger overrunning the interval is shrunk to fit
+		if want := start.Add(time.Duration(i) * 15 * time.Minute); !scheduled.at.Equal(want) {
+			t.Errorf("%s scheduled at %s, want %s", scheduled.feed.Name, scheduled.at, want)
+		}
+	}
+}
+
+func TestScheduleJitterStaysInInterval(t *testing.T) {
+	config := &Config{Interval: 600, Stagger: time.Minute, Jitter: time.Hour}
+	feeds := []Feed{{ID: "a", Name: "a"}, {ID: "b", Name: "b"}, {ID: "c", Name: "c"}}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for run := 0; run < 100; run++ {
+		for i, scheduled := range config.schedule(feeds, start) {
+			earliest := start.Add(time.Duration(i) * time.Minute)
+			if scheduled.at.Before(earliest) || !scheduled.at.Before(start.Add(config.interval())) {
+				t.Fatalf("%s scheduled at %s, outside %s to the end of the interval", scheduled.feed.Name, scheduled.at, earliest)
+			}
+		}
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	config := &Config{Interval: 600}
+	finished := time.Date(2024, 1, 1, 10, 7, 0, 0, time.UTC)
+
+	if got := (Feed{}).nextRun(config, finished); !got.Equal(finished.Add(10 * time.Minute)) {
+		t.Errorf("global interval: next run at %s", got)
+	}
+	if got := (Feed{Interval: time.Hour}).nextRun(config, finished); !got.Equal(finished.Add(time.Hour)) {
+		t.Errorf("feed interval: next run at %s", got)
+	}
+	schedule, err := cron.ParseStandard("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := (Feed{cronSchedule: schedule}).nextRun(config, finished); !got.Equal(time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("cron schedule: next run at %s", got)
+	}
+}
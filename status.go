@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// feedStatus is what /status reports about a feed.
+type feedStatus struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	NextRun     time.Time  `json:"next_run"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	// SyncedItems is how many GUIDs were recorded for the feed at its last check
+	SyncedItems int64 `json:"synced_items"`
+}
+
+var statuses = struct {
+	sync.Mutex
+	feeds map[string]*feedStatus
+}{feeds: make(map[string]*feedStatus)}
+
+func feedStatusFor(feed Feed) *feedStatus {
+	status, ok := statuses.feeds[feed.ID]
+	if !ok {
+		status = &feedStatus{ID: feed.ID, Name: feed.Name}
+		statuses.feeds[feed.ID] = status
+	}
+	return status
+}
+
+// recordNextRun notes when the feed is next due to be checked.
+func recordNextRun(feed Feed, at time.Time) {
+	statuses.Lock()
+	defer statuses.Unlock()
+	feedStatusFor(feed).NextRun = at
+	log.Printf("Next check of %s scheduled for %s", feed.Name, at.Format(time.RFC850))
+}
+
+// recordChecked notes when the feed was last checked.
+func recordChecked(feed Feed, at time.Time) {
+	statuses.Lock()
+	defer statuses.Unlock()
+	feedStatusFor(feed).LastChecked = &at
+}
+
+// recordSyncedItems notes how many GUIDs are recorded for the feed.
+func recordSyncedItems(feed Feed, count int64) {
+	statuses.Lock()
+	defer statuses.Unlock()
+	feedStatusFor(feed).SyncedItems = count
+}
+
+// statusHandler reports the schedule of every enabled feed, and whether each
+// Gitlab instance can be reached, as JSON.
+func statusHandler(gitlabs gitlabInstances) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses.Lock()
+		feeds := make([]feedStatus, 0, len(statuses.feeds))
+		for _, status := range statuses.feeds {
+			feeds = append(feeds, *status)
+		}
+		statuses.Unlock()
+
+		sort.Slice(feeds, func(i, j int) bool { return feeds[i].ID < feeds[j].ID })
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(map[string]interface{}{"feeds": feeds, "gitlab": gitlabs.check()})
+		if err != nil {
+			log.Printf("Unable to write status response: %v", err)
+		}
+	}
+}
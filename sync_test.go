@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// fakeGitlab records the issues created through it, and answers listings and
+// searches with no issues unless told otherwise. The issues it created can be
+// looked up and linked.
+type fakeGitlab struct {
+	mu       sync.Mutex
+	created  []map[string]any
+	requests []string
+	// search answers a GET of the project's search endpoint when set
+	search func(w http.ResponseWriter, r *http.Request)
+}
+
+func (fake *fakeGitlab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.requests = append(fake.requests, r.Method+" "+r.URL.Path)
+	var iid int
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v4/projects/1/issues":
+		var options map[string]any
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &options); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fake.created = append(fake.created, options)
+		iid := len(fake.created)
+		fmt.Fprintf(w, `{"id": %d, "iid": %d, "project_id": 1, "web_url": "https://gitlab.example.com/issues/%d"}`, 100+iid, iid, iid)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v4/projects/1/-/search" && fake.search != nil:
+		fake.search(w, r)
+	case r.Method == http.MethodGet && scan(r.URL.Path, "/api/v4/projects/1/issues/%d", &iid) && iid <= len(fake.created):
+		fmt.Fprintf(w, `{"id": %d, "iid": %d, "project_id": 1, "web_url": "https://gitlab.example.com/issues/%d"}`, 100+iid, iid, iid)
+	case r.Method == http.MethodPost && scan(r.URL.Path, "/api/v4/projects/1/issues/%d/links", &iid):
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	case r.Method == http.MethodGet:
+		fmt.Fprint(w, `[]`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// scan reports whether path is format, reading its number into iid.
+func scan(path, format string, iid *int) bool {
+	n, err := fmt.Sscanf(path, format, iid)
+	return err == nil && n == 1 && fmt.Sprintf(format, *iid) == path
+}
+
+func (fake *fakeGitlab) titles() []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	var titles []string
+	for _, options := range fake.created {
+		titles = append(titles, fmt.Sprint(options["title"]))
+	}
+	return titles
+}
+
+// newTestSync sets up checkFeed for a feed serving rss with an ETag, syncing to
+// project 1 of fake, with fresh metrics and no issue budget.
+func newTestSync(t *testing.T, rss string, fake *fakeGitlab) (Feed, *redis.Client, *gitlab.Client) {
+	t.Helper()
+	registerer := prometheus.DefaultRegisterer
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+	t.Cleanup(func() { prometheus.DefaultRegisterer = registerer })
+	registerMetrics()
+	gitlabAvailability = newAvailability(nil, time.Minute)
+	issueCreationBudget = nil
+
+	_, redisClient := newTestRedis(t)
+	gitlabClient := newTestGitlab(t, fake.ServeHTTP)
+	feed := newTestFeed(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, rss)
+	})
+	feed.GitlabProjectID = 1
+	return feed, redisClient, gitlabClient
+}
+
+func TestCheckFeedCreatesOldestFirst(t *testing.T) {
+	rss := `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Test</title>
+<item><title>Third</title><guid>urn:item:3</guid><pubDate>Wed, 03 Jan 2024 00:00:00 GMT</pubDate></item>
+<item><title>First</title><guid>urn:item:1</guid><pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate></item>
+<item><title>Undated</title><guid>urn:item:0</guid></item>
+<item><title>Second</title><guid>urn:item:2</guid><pubDate>Tue, 02 Jan 2024 00:00:00 GMT</pubDate></item>
+</channel></rss>`
+	fake := &fakeGitlab{}
+	feed, redisClient, gitlabClient := newTestSync(t, rss, fake)
+	feed.Retroactive = true
+
+	feed.checkFeed(redisClient, gitlabClient)
+
+	if got, want := fake.titles(), []string{"First", "Second", "Third"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("created %v, want %v", got, want)
+	}
+	var previous time.Time
+	for _, options := range fake.created {
+		createdAt, err := time.Parse(time.RFC3339, fmt.Sprint(options["created_at"]))
+		if err != nil {
+			t.Fatalf("created_at of %v: %v", options["title"], err)
+		}
+		if !createdAt.After(previous) {
+			t.Errorf("%v created at %s, after %s", options["title"], createdAt, previous)
+		}
+		previous = createdAt
+	}
+}
+
+func TestCheckFeedConfidential(t *testing.T) {
+	for _, confidential := range []bool{false, true} {
+		fake := &fakeGitlab{}
+		feed, redisClient, gitlabClient := newTestSync(t, testRSS, fake)
+		feed.Confidential = confidential
+
+		feed.checkFeed(redisClient, gitlabClient)
+
+		if len(fake.created) != 1 {
+			t.Fatalf("created %d issues, want 1", len(fake.created))
+		}
+		if got := fake.created[0]["confidential"] == true; got != confidential {
+			t.Errorf("confidential feed %v created an issue with confidential %v", confidential, fake.created[0]["confidential"])
+		}
+	}
+}
+
+func TestCheckFeedSearchErrorCreatesNothing(t *testing.T) {
+	fake := &fakeGitlab{search: func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "403 Forbidden"}`, http.StatusForbidden)
+	}}
+	feed, redisClient, gitlabClient := newTestSync(t, testRSS, fake)
+
+	feed.checkFeed(redisClient, gitlabClient)
+
+	if len(fake.created) != 0 {
+		t.Errorf("created %v after the search failed", fake.titles())
+	}
+	if synced, _ := redisClient.SIsMember(context.Background(), feed.ID, "urn:item:1").Result(); synced {
+		t.Error("item was marked as synced after the search failed")
+	}
+	if got := testutil.ToFloat64(gitlabSearchErrorCounter.WithLabelValues(feed.Name)); got != 1 {
+		t.Errorf("gitlab_search_error_total = %v, want 1", got)
+	}
+}
+
+// saddCounter is a Redis hook counting the round trips adding to a set, and
+// the members each adds.
+type saddCounter struct {
+	key     string
+	members []int
+}
+
+func (counter *saddCounter) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (counter *saddCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		counter.count([]redis.Cmder{cmd})
+		return next(ctx, cmd)
+	}
+}
+
+func (counter *saddCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		counter.count(cmds)
+		return next(ctx, cmds)
+	}
+}
+
+func (counter *saddCounter) count(cmds []redis.Cmder) {
+	members := 0
+	for _, cmd := range cmds {
+		if args := cmd.Args(); cmd.Name() == "sadd" && len(args) > 1 && args[1] == counter.key {
+			members += len(args) - 2
+		}
+	}
+	if members > 0 {
+		counter.members = append(counter.members, members)
+	}
+}
+
+func TestCheckFeedMarksExpiredItemsTogether(t *testing.T) {
+	rss := `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Test</title>
+<item><title>Old</title><guid>urn:item:1</guid><pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate></item>
+<item><title>Older</title><guid>urn:item:2</guid><pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate></item>
+<item><title>Oldest</title><guid>urn:item:3</guid><pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate></item>
+</channel></rss>`
+	fake := &fakeGitlab{}
+	feed, redisClient, gitlabClient := newTestSync(t, rss, fake)
+	feed.AddedSince = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	counter := &saddCounter{key: feed.ID}
+	redisClient.AddHook(counter)
+
+	feed.checkFeed(redisClient, gitlabClient)
+
+	if len(fake.created) != 0 {
+		t.Errorf("created %v for items before added_since", fake.titles())
+	}
+	if fmt.Sprint(counter.members) != "[3]" {
+		t.Errorf("marked the expired items with round trips adding %v GUIDs, want one adding all 3", counter.members)
+	}
+	ctx := context.Background()
+	if count, _ := redisClient.SCard(ctx, feed.ID).Result(); count != 3 {
+		t.Errorf("%d GUIDs marked, want 3", count)
+	}
+	if count, _ := redisClient.HLen(ctx, syncedAtKey(feed.ID)).Result(); count != 3 {
+		t.Errorf("%d synced times recorded, want 3", count)
+	}
+}
+
+func TestMarkSynced(t *testing.T) {
+	server, client := newTestRedis(t)
+	feed := Feed{ID: "feed", Name: "feed"}
+	server.HSet(syncedAtKey(feed.ID), "a", "1")
+
+	if err := feed.markSynced(client, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if members, _ := server.Members(feed.ID); fmt.Sprint(members) != "[a b]" {
+		t.Errorf("members = %v", members)
+	}
+	if got := server.HGet(syncedAtKey(feed.ID), "a"); got != "1" {
+		t.Errorf("marking again changed when a was synced to %s", got)
+	}
+
+	feed.DryRun = true
+	if err := feed.markSynced(client, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := server.SIsMember(feed.ID, "c"); ok {
+		t.Error("a dry run marked an item")
+	}
+}
+
+func BenchmarkMarkSynced(b *testing.B) {
+	guids := make([]string, 500)
+	for i := range guids {
+		guids[i] = fmt.Sprintf("urn:item:%d", i)
+	}
+	feed := Feed{ID: "feed", Name: "feed"}
+	b.Run("per item", func(b *testing.B) {
+		_, client := newTestRedis(b)
+		for i := 0; i < b.N; i++ {
+			for _, guid := range guids {
+				if err := feed.markSynced(client, guid); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		_, client := newTestRedis(b)
+		for i := 0; i < b.N; i++ {
+			if err := feed.markSynced(client, guids...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestCheckFeedLinksRelatedItems(t *testing.T) {
+	rss := `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Test</title>
+<item><title>Update</title><link>https://status.example.com/incident/1/update</link><guid>https://status.example.com/incident/1/update</guid>
+<description>Follow-up to https://status.example.com/incident/1</description><pubDate>Tue, 02 Jan 2024 00:00:00 GMT</pubDate></item>
+<item><title>Incident</title><link>https://status.example.com/incident/1</link><guid>https://status.example.com/incident/1</guid><pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate></item>
+</channel></rss>`
+	fake := &fakeGitlab{}
+	feed, redisClient, gitlabClient := newTestSync(t, rss, fake)
+	feed.LinkRelated = true
+
+	feed.checkFeed(redisClient, gitlabClient)
+
+	if got := fake.titles(); fmt.Sprint(got) != "[Incident Update]" {
+		t.Fatalf("created %v", got)
+	}
+	if description := fmt.Sprint(fake.created[1]["description"]); !strings.HasPrefix(description, "Related to #1\n\n") {
+		t.Errorf("follow-up description doesn't point at the incident:\n%s", description)
+	}
+	if fmt.Sprint(fake.created[0]["description"]) == "" || strings.HasPrefix(fmt.Sprint(fake.created[0]["description"]), "Related to") {
+		t.Errorf("first item was related to something: %v", fake.created[0]["description"])
+	}
+	linked := false
+	for _, request := range fake.requests {
+		linked = linked || request == "POST /api/v4/projects/1/issues/2/links"
+	}
+	if !linked {
+		t.Errorf("follow-up wasn't linked, requests: %v", fake.requests)
+	}
+}
+
+func TestCheckFeedFollowUpKeepsFeedOptions(t *testing.T) {
+	fake := &fakeGitlab{}
+	feed, redisClient, gitlabClient := newTestSync(t, testRSS, fake)
+	feed.Confidential = true
+	feed.TrackUpdates = true
+	feed.IssueType = "incident"
+	ctx := context.Background()
+	// Synced before with different content, and no issue recorded for it
+	if err := feed.markSynced(redisClient, "urn:item:1"); err != nil {
+		t.Fatal(err)
+	}
+	redisClient.HSet(ctx, contentHashesKey(feed.ID), "urn:item:1", "outdated")
+
+	feed.checkFeed(redisClient, gitlabClient)
+
+	if got := fake.titles(); fmt.Sprint(got) != "[Updated: First]" {
+		t.Fatalf("created %v, want the follow-up", got)
+	}
+	if options := fake.created[0]; options["confidential"] != true || options["issue_type"] != "incident" {
+		t.Errorf("follow-up created with %v", options)
+	}
+	if hash, _ := redisClient.HGet(ctx, contentHashesKey(feed.ID), "urn:item:1").Result(); hash == "outdated" {
+		t.Error("content hash wasn't updated after the follow-up")
+	}
+}
+
+func TestCheckFeedFollowUpUsesBudget(t *testing.T) {
+	fake := &fakeGitlab{}
+	feed, redisClient, gitlabClient := newTestSync(t, testRSS, fake)
+	feed.TrackUpdates = true
+	issueCreationBudget = newIssueBudget(1, time.Hour)
+	issueCreationBudget.take()
+	if err := feed.markSynced(redisClient, "urn:item:1"); err != nil {
+		t.Fatal(err)
+	}
+	redisClient.HSet(context.Background(), contentHashesKey(feed.ID), "urn:item:1", "outdated")
+
+	feed.checkFeed(redisClient, gitlabClient)
+
+	if len(fake.created) != 0 {
+		t.Errorf("created %v with max_issues_per_run used up", fake.titles())
+	}
+	if hash, _ := redisClient.HGet(context.Background(), contentHashesKey(feed.ID), "urn:item:1").Result(); hash != "outdated" {
+		t.Error("deferred follow-up was recorded as done")
+	}
+}
+
+func TestCheckFeedSavesValidatorsOnceItemsAreSynced(t *testing.T) {
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "403 Forbidden"}`, http.StatusForbidden)
+	}
+	fake := &fakeGitlab{search: failing}
+	feed, redisClient, gitlabClient := newTestSync(t, testRSS, fake)
+	etag := func() string {
+		value, _ := redisClient.HGet(context.Background(), fetchStateKey(feed.ID), "etag").Result()
+		return value
+	}
+
+	feed.checkFeed(redisClient, gitlabClient)
+	if got := etag(); got != "" {
+		t.Fatalf("ETag %s saved with the item left for the next run", got)
+	}
+
+	fake.search = nil
+	feed.checkFeed(redisClient, gitlabClient)
+	if len(fake.created) != 1 {
+		t.Fatalf("created %v on the second check", fake.titles())
+	}
+	if got := etag(); got != `"v1"` {
+		t.Fatalf("ETag %q after a clean check", got)
+	}
+
+	requests := len(fake.requests)
+	feed.checkFeed(redisClient, gitlabClient)
+	if got := testutil.ToFloat64(feedNotModifiedCounter.WithLabelValues(feed.Name)); got != 1 || len(fake.requests) != requests {
+		t.Errorf("unchanged feed checked again: %v not modified, %d Gitlab requests", got, len(fake.requests)-requests)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// syncIDPrefix starts the marker markerFor writes.
+const syncIDPrefix = "<!-- rss-sync-id: "
+
+// markerFor is the hidden marker identifying the issue created for a GUID of
+// a feed, a hash of both so it can be recomputed for any item and doesn't
+// depend on how Gitlab's search treats the GUID.
+func markerFor(feedID, guid string) string {
+	sum := sha256.Sum256([]byte(feedID + "|" + guid))
+	return syncIDPrefix + hex.EncodeToString(sum[:]) + " -->"
+}
+
+// descriptionMatches reports whether a description is that of the issue
+// created for the feed's GUID. Descriptions with a markerFor marker only match
+// their own, so another feed's item with the same GUID doesn't. Older ones are
+// matched by descriptionHasGUID.
+func descriptionMatches(description, feedID, guid string) bool {
+	if strings.Contains(description, syncIDPrefix) {
+		return strings.Contains(description, markerFor(feedID, guid))
+	}
+	return descriptionHasGUID(description, guid)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDescriptionMatchesSyncID(t *testing.T) {
+	description := "Body\n\n<!-- guid: urn:item:1 -->\n\n" + markerFor("feed-a", "urn:item:1")
+	if !descriptionMatches(description, "feed-a", "urn:item:1") {
+		t.Error("description doesn't match the feed and GUID its marker was computed for")
+	}
+	if descriptionMatches(description, "feed-b", "urn:item:1") {
+		t.Error("description matches another feed with the same GUID")
+	}
+	if !descriptionMatches("Body<br>link<br>urn:item:1", "feed-b", "urn:item:1") {
+		t.Error("description without a marker doesn't match by GUID")
+	}
+
+	markers := map[string]string{markerFor("feed-a", "urn:item:1"): "urn:item:1"}
+	pending := map[string]bool{"urn:item:1": true}
+	if got := descriptionGUIDs(description, pending, markers); !reflect.DeepEqual(got, []string{"urn:item:1"}) {
+		t.Errorf("descriptionGUIDs with markers = %v", got)
+	}
+}
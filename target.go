@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// targetsEpics reports whether the feed creates group epics instead of
+// project issues.
+func (feed Feed) targetsEpics() bool {
+	return feed.Target == "epic"
+}
+
+// validateTarget checks the feed's target, and that a feed creating epics
+// doesn't use options only issues have.
+func (feed Feed) validateTarget() error {
+	switch feed.Target {
+	case "", "issue":
+		return nil
+	case "epic":
+	default:
+		return fmt.Errorf("invalid target %q, expected issue or epic", feed.Target)
+	}
+	if feed.GitlabGroupID == 0 {
+		return errors.New("target epic requires gitlab_group_id")
+	}
+	unsupported := []struct {
+		option string
+		set    bool
+	}{
+		{"assignee_ids", len(feed.AssigneeIDs) > 0},
+		{"assignee_usernames", len(feed.AssigneeUsernames) > 0},
+		{"author_assignee_map", len(feed.AuthorAssigneeMap) > 0},
+		{"milestone", feed.Milestone != ""},
+		{"due_in", feed.DueIn != ""},
+		{"weight", feed.Weight != nil},
+		{"issue_type", feed.IssueType != ""},
+		{"epic_id", feed.EpicID != 0 || feed.EpicIID != 0},
+		{"on_duplicate", feed.OnDuplicate == "comment"},
+		{"dedupe_by_title", feed.DedupeByTitle},
+		{"link_related", feed.LinkRelated},
+		{"track_updates", feed.tracksUpdates()},
+		{"state", feed.State == "closed"},
+		{"use_graphql", feed.UseGraphQL},
+	}
+	for _, check := range unsupported {
+		if check.set {
+			return fmt.Errorf("%s can't be used with target epic", check.option)
+		}
+	}
+	return nil
+}
+
+// syncEpic creates the epic for a new item in the feed's group, unless the
+// group already has one. It reports whether the item was marked as synced, and
+// whether it was deferred by max_issues_per_run.
+func (feed Feed) syncEpic(redisClient *redis.Client, gitlabClient *gitlab.Client, item *gofeed.Item, itemTime *time.Time) (marked, deferred bool) {
+	existing, err := hasExistingGitlabEpic(feed.ID, item.GUID, feed.GitlabGroupID, gitlabClient)
+	if err != nil {
+		// Left unmarked in Redis so it's checked again on the next run
+		log.Printf("Unable to query Gitlab for existing epics for GUID %s, skipping '%s' until the next run: %v\n", item.GUID, item.Title, err)
+		gitlabSearchErrorCounter.WithLabelValues(feed.Name).Inc()
+		return false, false
+	}
+	if existing != nil {
+		if err := feed.markSynced(redisClient, item.GUID); err != nil {
+			log.Printf("Error adding existing GUID %s to Redis for feed %s: %v", item.GUID, feed.Name, err)
+			return false, false
+		}
+		return true, false
+	}
+
+	if !feed.isDryRun() && !issueCreationBudget.take() {
+		// Left unmarked in Redis so it's picked up on the next run
+		issueCreationDeferredCounter.WithLabelValues(feed.Name).Inc()
+		return false, true
+	}
+
+	now := time.Now()
+	epicTime := &now
+	if feed.Retroactive {
+		epicTime = itemTime
+	}
+	labels := gitlab.LabelOptions(feed.issueLabels(item))
+	epicOptions := &gitlab.CreateEpicOptions{
+		Title:       gitlab.String(feed.issueTitle(item)),
+		Description: gitlab.String(feed.issueDescription(item)),
+		Labels:      &labels,
+		CreatedAt:   epicTime,
+	}
+	if feed.Confidential {
+		epicOptions.Confidential = gitlab.Bool(true)
+	}
+
+	if feed.isDryRun() {
+		log.Printf("[dry run] Would create Gitlab epic '%s' in group: %d with labels: %s", item.Title, feed.GitlabGroupID, strings.Join(labels, ", "))
+		issuesSkippedDryRunCounter.WithLabelValues(feed.Name).Inc()
+		return false, false
+	}
+
+	epic, _, err := gitlabClient.Epics.CreateEpic(feed.GitlabGroupID, epicOptions, gitlab.WithContext(creating(context.Background())))
+	if err != nil {
+		log.Printf("Unable to create Gitlab epic for %s: %v\n", item.Title, err)
+		epicCreationErrorCounter.Inc()
+		issueCreationBudget.giveBack()
+		return false, false
+	}
+	if err := feed.markSynced(redisClient, item.GUID); err != nil {
+		log.Printf("Unable to persist in %s Redis: %s \n", item.Title, err)
+		return false, false
+	}
+	epicsCreatedCounter.Inc()
+	log.Printf("Created Gitlab epic '%s' in group: %d (%s)\n", item.Title, feed.GitlabGroupID, epic.WebURL)
+	return true, false
+}
+
+// hasExistingGitlabEpic is hasExistingGitlabIssue for feeds creating epics,
+// searching the group's epics for the GUID.
+func hasExistingGitlabEpic(feedID, guid string, groupID int, gitlabClient *gitlab.Client) (*gitlab.Epic, error) {
+	opt := &gitlab.ListGroupEpicsOptions{
+		ListOptions: gitlab.ListOptions{Page: 1, PerPage: 100},
+		Search:      gitlab.String(guid),
+	}
+	var existing *gitlab.Epic
+	for page := 0; page < maxSearchPages && existing == nil; page++ {
+		candidates, resp, err := gitlabClient.Epics.ListGroupEpics(groupID, opt, gitlab.WithContext(context.Background()))
+		if err != nil {
+			return nil, err
+		}
+		for _, candidate := range candidates {
+			if descriptionMatches(candidate.Description, feedID, guid) && (existing == nil || candidate.IID < existing.IID) {
+				existing = candidate
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	if existing != nil {
+		log.Printf("Found existing epic for %s in group (%s). Marking as syncronised.\n", guid, existing.WebURL)
+	}
+	return existing, nil
+}
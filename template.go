@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// templateData is what title_template and description_template are executed
+// with: the item's fields, the feed as .Feed, the item's converted and
+// truncated body as .Body and the hidden GUID marker as .GUIDMarker.
+type templateData struct {
+	*gofeed.Item
+	Feed templateFeed
+	Body string
+}
+
+func (data templateData) GUIDMarker() string {
+	return guidMarker(data.GUID)
+}
+
+type templateFeed struct {
+	Name   string
+	Labels []string
+}
+
+// footerData is what footer_template is executed with.
+type footerData struct {
+	FeedName string
+	FeedURL  string
+	Link     string
+	GUID     string
+	SyncedAt time.Time
+}
+
+// compileTemplates parses the feed's title, description and footer templates,
+// and warns when the description template leaves out the GUID marker
+// hasExistingGitlabIssue looks for.
+func (feed *Feed) compileTemplates() error {
+	var err error
+	if feed.FooterTemplate != "" {
+		if feed.footerTemplate, err = template.New("footer_template").Parse(feed.FooterTemplate); err != nil {
+			return err
+		}
+		if _, err = feed.renderFooter(sampleItem()); err != nil {
+			return err
+		}
+	}
+	if feed.TitleTemplate != "" {
+		if feed.titleTemplate, err = template.New("title_template").Parse(feed.TitleTemplate); err != nil {
+			return err
+		}
+	}
+	if feed.DescriptionTemplate != "" {
+		if feed.descriptionTemplate, err = template.New("description_template").Parse(feed.DescriptionTemplate); err != nil {
+			return err
+		}
+		sample := sampleItem()
+		rendered, err := feed.render(feed.descriptionTemplate, sample, "")
+		if err != nil {
+			return err
+		}
+		if !descriptionHasGUID(rendered, sample.GUID) {
+			log.Printf("WARNING: description_template of feed %s has no {{.GUIDMarker}}, it is appended to the description so duplicates can be found", feed.Name)
+		}
+	}
+	return nil
+}
+
+// sampleItem is the item templates are tried out on at startup. Every field
+// the templates are documented to see is set, so a valid template doesn't fail
+// on a nil one.
+func sampleItem() *gofeed.Item {
+	now := time.Now()
+	author := &gofeed.Person{Name: "Author", Email: "author@example.com"}
+	return &gofeed.Item{
+		Title:           "Title",
+		Description:     "Description",
+		Content:         "Content",
+		Link:            "https://example.com/",
+		Links:           []string{"https://example.com/"},
+		Updated:         now.Format(time.RFC1123Z),
+		UpdatedParsed:   &now,
+		Published:       now.Format(time.RFC1123Z),
+		PublishedParsed: &now,
+		Author:          author,
+		Authors:         []*gofeed.Person{author},
+		GUID:            "sample-guid-0123456789",
+		Image:           &gofeed.Image{URL: "https://example.com/image.png", Title: "Image"},
+		Categories:      []string{"Category"},
+		Enclosures:      []*gofeed.Enclosure{{URL: "https://example.com/file.mp3", Length: "1024", Type: "audio/mpeg"}},
+	}
+}
+
+func (feed Feed) render(tmpl *template.Template, item *gofeed.Item, body string) (string, error) {
+	var out strings.Builder
+	data := templateData{Item: item, Feed: templateFeed{Name: feed.Name, Labels: feed.Labels}, Body: body}
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("executing %s: %w", tmpl.Name(), err)
+	}
+	return out.String(), nil
+}
+
+// issueTitle is the title of the issue created from item, from the feed's
+// title_template when it has one.
+func (feed Feed) issueTitle(item *gofeed.Item) string {
+	if feed.titleTemplate == nil {
+		return item.Title
+	}
+	title, err := feed.render(feed.titleTemplate, item, "")
+	if err != nil {
+		log.Printf("Unable to render the title of '%s' from %s, using the item title: %v", item.Title, feed.Name, err)
+		return item.Title
+	}
+	return strings.TrimSpace(title)
+}
+
+// footer is the line ending the default issue description, from the feed's
+// footer_template or pointing at the item's link.
+func (feed Feed) footer(item *gofeed.Item) string {
+	if !feed.showsFooter() {
+		return ""
+	}
+	if feed.footerTemplate != nil {
+		footer, err := feed.renderFooter(item)
+		if err == nil {
+			return strings.TrimSpace(footer)
+		}
+		log.Printf("Unable to render the footer of '%s' from %s, using the default: %v", item.Title, feed.Name, err)
+	}
+	if item.Link == "" {
+		return ""
+	}
+	return "Source: " + item.Link
+}
+
+func (feed Feed) renderFooter(item *gofeed.Item) (string, error) {
+	var out strings.Builder
+	data := footerData{FeedName: feed.Name, FeedURL: redactURL(feed.FeedURL), Link: item.Link, GUID: item.GUID, SyncedAt: time.Now()}
+	if err := feed.footerTemplate.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("executing %s: %w", feed.footerTemplate.Name(), err)
+	}
+	return out.String(), nil
+}
+
+// templatedDescription renders the feed's description_template, adding the
+// GUID marker when the template left it out, ahead of any quick actions ending
+// the template.
+func (feed Feed) templatedDescription(item *gofeed.Item) (string, error) {
+	rendered, err := feed.render(feed.descriptionTemplate, item, feed.issueBody(item))
+	if err != nil {
+		return "", err
+	}
+	description, quickActions := splitQuickActions(rendered)
+	if !descriptionHasGUID(description, item.GUID) {
+		description += "\n\n" + guidMarker(item.GUID)
+	}
+	return description + quickActions, nil
+}
+
+// quickActionPattern matches a line holding a Gitlab quick action.
+var quickActionPattern = regexp.MustCompile(`^/[a-z_]+(\s|$)`)
+
+// splitQuickActions splits the block of quick actions ending a description off
+// it, blank lines included, so what is appended to descriptions goes before
+// them. Quick actions have to be on lines of their own.
+func splitQuickActions(description string) (string, string) {
+	lines := strings.Split(description, "\n")
+	start := len(lines)
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && !quickActionPattern.MatchString(line) {
+			break
+		}
+		if line != "" {
+			start = i
+		}
+	}
+	if start == len(lines) {
+		return description, ""
+	}
+	body := strings.TrimRight(strings.Join(lines[:start], "\n"), "\n")
+	return body, "\n\n" + strings.Join(lines[start:], "\n")
+}
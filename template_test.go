@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSplitQuickActions(t *testing.T) {
+	tests := []struct {
+		description, body, quickActions string
+	}{
+		{"Body", "Body", ""},
+		{"Body\n\n/label ~security\n/assign @me\n", "Body", "\n\n/label ~security\n/assign @me\n"},
+		{"Body\n/label ~a\n\n/due tomorrow", "Body", "\n\n/label ~a\n\n/due tomorrow"},
+		{"/label ~a\nBody", "/label ~a\nBody", ""},
+		{"Body\nsee /usr/bin", "Body\nsee /usr/bin", ""},
+	}
+	for _, test := range tests {
+		body, quickActions := splitQuickActions(test.description)
+		if body != test.body || quickActions != test.quickActions {
+			t.Errorf("splitQuickActions(%q) = %q, %q, want %q, %q", test.description, body, quickActions, test.body, test.quickActions)
+		}
+	}
+}
+
+func TestCompileTemplatesSampleItem(t *testing.T) {
+	feed := Feed{
+		ID:                  "feed",
+		Name:                "feed",
+		DescriptionTemplate: "{{.Body}}\n\nBy {{.Author.Name}} <{{.Author.Email}}> in {{index .Categories 0}}: {{.Content}}\n\n{{.GUIDMarker}}",
+	}
+	if err := feed.compileTemplates(); err != nil {
+		t.Fatalf("compileTemplates() = %v, want nil", err)
+	}
+
+	feed.DescriptionTemplate = "{{.Author.Missing}}"
+	if err := feed.compileTemplates(); err == nil {
+		t.Error("compileTemplates() accepted a template using an unknown field")
+	}
+}
+
+func TestIssueDescriptionKeepsQuickActionsLast(t *testing.T) {
+	feed := Feed{
+		ID:                  "feed",
+		Name:                "feed",
+		MetadataFooter:      true,
+		DescriptionTemplate: "{{.Body}}\n\nSource: {{.Link}}\n\n/label ~rss\n/due in 7 days\n",
+	}
+	if err := feed.compileTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	item := &gofeed.Item{Title: "Title", Link: "https://example.com/1", GUID: "urn:item:1", Description: "Body text"}
+
+	description := feed.issueDescription(item)
+	order := []string{"Body text", "Source: https://example.com/1", guidMarker(item.GUID), markerFor(feed.ID, item.GUID), metadataStart, "/label ~rss\n/due in 7 days"}
+	offset := 0
+	for _, part := range order {
+		i := strings.Index(description[offset:], part)
+		if i < 0 {
+			t.Fatalf("%q missing or out of order in:\n%s", part, description)
+		}
+		offset += i + len(part)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(description), "/due in 7 days") {
+		t.Errorf("description doesn't end with the quick actions:\n%s", description)
+	}
+
+	bodyTruncatedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_body_truncated_total"}, []string{"feed"})
+	feed.MaxDescriptionLength = len(description) + 50
+	truncated := feed.issueDescription(&gofeed.Item{Title: "Title", Link: item.Link, GUID: item.GUID, Description: strings.Repeat("Body text ", 30)})
+	if !strings.Contains(truncated, "…truncated") {
+		t.Fatalf("description wasn't truncated:\n%s", truncated)
+	}
+	if len(truncated) > feed.MaxDescriptionLength || !strings.HasSuffix(strings.TrimSpace(truncated), "/due in 7 days") {
+		t.Errorf("truncated description lost its quick actions:\n%s", truncated)
+	}
+}
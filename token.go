@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// tokenFile is a Gitlab token read from a file, such as a mounted Kubernetes
+// secret, which may be rotated while the service runs.
+type tokenFile struct {
+	path string
+
+	mu    sync.Mutex
+	token string
+}
+
+// newTokenFile reads the token in path.
+func newTokenFile(path string) (*tokenFile, error) {
+	file := &tokenFile{path: path}
+	if _, err := file.reload(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (file *tokenFile) get() string {
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	return file.token
+}
+
+// reload reads the token from the file again, reporting whether it changed.
+func (file *tokenFile) reload() (bool, error) {
+	data, err := os.ReadFile(file.path)
+	if err != nil {
+		return false, fmt.Errorf("reading Gitlab token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return false, fmt.Errorf("Gitlab token file %s is empty", file.path)
+	}
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	changed := token != file.token
+	file.token = token
+	return changed, nil
+}
+
+// tokenTransport authenticates requests with the token from a tokenFile, in
+// place of the one the Gitlab client was created with. A 401 reloads the
+// file, and the request is sent once more if the token changed.
+type tokenTransport struct {
+	base   http.RoundTripper
+	file   *tokenFile
+	header string
+	prefix string
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := t.file.get()
+	resp, err := t.base.RoundTrip(t.authenticate(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	changed, reloadErr := t.file.reload()
+	if reloadErr != nil {
+		log.Printf("Gitlab answered 401 and the token couldn't be reloaded: %v", reloadErr)
+		return resp, nil
+	}
+	if !changed || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	log.Printf("Gitlab answered 401, retrying %s with the token reloaded from %s", req.URL.Path, t.file.path)
+	resp.Body.Close()
+	retry := t.authenticate(req, t.file.get())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(retry)
+}
+
+func (t *tokenTransport) authenticate(req *http.Request, token string) *http.Request {
+	authenticated := req.Clone(req.Context())
+	authenticated.Header.Set(t.header, t.prefix+token)
+	return authenticated
+}
+
+// newGitlabClient creates a client authenticating with a token of the given
+// type: pat (a personal, project or group access token), job (a CI job token)
+// or oauth. The token is read from file instead when one is given.
+func newGitlabClient(baseURL, tokenType, token, path string) (*gitlab.Client, error) {
+	options := gitlabClientOptions(baseURL)
+	if path != "" {
+		file, err := newTokenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		token = file.get()
+		transport := &tokenTransport{base: http.DefaultTransport.(*http.Transport).Clone(), file: file}
+		switch tokenType {
+		case "job":
+			transport.header = "JOB-TOKEN"
+		case "oauth":
+			transport.header, transport.prefix = "Authorization", "Bearer "
+		default:
+			transport.header = "PRIVATE-TOKEN"
+		}
+		options = append(options, gitlab.WithHTTPClient(&http.Client{Transport: transport}))
+	}
+
+	switch tokenType {
+	case "job":
+		return gitlab.NewJobClient(token, options...)
+	case "oauth":
+		return gitlab.NewOAuthClient(token, options...)
+	default:
+		return gitlab.NewClient(token, options...)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+func TestTokenFileReloadedOn401(t *testing.T) {
+	tests := []struct {
+		tokenType, header, prefix string
+	}{
+		{"pat", "PRIVATE-TOKEN", ""},
+		{"job", "JOB-TOKEN", ""},
+		{"oauth", "Authorization", "Bearer "},
+	}
+	for _, test := range tests {
+		var seen []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.Header.Get(test.header))
+			if r.Header.Get(test.header) != test.prefix+"rotated" {
+				http.Error(w, `{"message": "401 Unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id": 70, "iid": 7}`)
+		}))
+		path := filepath.Join(t.TempDir(), "token")
+		if err := os.WriteFile(path, []byte("original\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		client, err := newGitlabClient(server.URL+"/api/v4", test.tokenType, "", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		create := func() error {
+			_, _, err := client.Issues.CreateIssue(1, &gitlab.CreateIssueOptions{Title: gitlab.Ptr("Title")}, gitlab.WithContext(creating(context.Background())))
+			return err
+		}
+		if err := create(); err == nil {
+			t.Errorf("%s: created an issue with the original token", test.tokenType)
+		}
+		if err := os.WriteFile(path, []byte("rotated\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		seen = nil
+		if err := create(); err != nil {
+			t.Errorf("%s: creating with the rotated token failed: %v", test.tokenType, err)
+		}
+		if want := []string{test.prefix + "original", test.prefix + "rotated"}; fmt.Sprint(seen) != fmt.Sprint(want) {
+			t.Errorf("%s: sent %q, want %q", test.tokenType, seen, want)
+		}
+		server.Close()
+	}
+}
+
+func TestTokenFileEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(" \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTokenFile(path); err == nil {
+		t.Error("empty token file was accepted")
+	}
+}
+
+func TestSecondaryInstanceToken(t *testing.T) {
+	var seen string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"version": "17.0.0"}`)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("INTERNAL_GITLAB_TOKEN", "")
+	t.Setenv("INTERNAL_GITLAB_TOKEN_FILE", path)
+	env := EnvValues{GitlabAPIBaseUrl: "https://gitlab.example.com/api/v4", GitlabAPIKey: "default", GitlabTokenType: "pat"}
+	config := &Config{Feeds: []Feed{{
+		Name:            "internal",
+		GitlabBaseURL:   server.URL + "/api/v4",
+		GitlabTokenEnv:  "INTERNAL_GITLAB_TOKEN",
+		GitlabTokenType: "oauth",
+	}}}
+
+	gitlabs, err := newGitlabInstances(env, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := gitlabs.forFeed(config.Feeds[0]).Version.GetVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if seen != "Bearer from-file" {
+		t.Errorf("sent Authorization %q, want the oauth token from INTERNAL_GITLAB_TOKEN_FILE", seen)
+	}
+
+	t.Setenv("INTERNAL_GITLAB_TOKEN_FILE", "")
+	if _, err := newGitlabInstances(env, config); err == nil {
+		t.Error("newGitlabInstances() created a client without a token")
+	}
+}
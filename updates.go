@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/mmcdole/gofeed"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// contentHashesKey is the Redis hash mapping each GUID of a feed to the hash of
+// its content when it was last synced.
+func contentHashesKey(feedID string) string {
+	return feedID + ":content_hashes"
+}
+
+// contentHash fingerprints the parts of an item that end up in its issue.
+func contentHash(item *gofeed.Item) string {
+	sum := sha256.Sum256([]byte(item.Title + "\n" + itemBody(item)))
+	return hex.EncodeToString(sum[:])
+}
+
+// rememberContent records the item's content hash so later changes to the item
+// can be detected.
+func (feed Feed) rememberContent(redisClient *redis.Client, item *gofeed.Item) {
+	if err := redisClient.HSet(context.Background(), contentHashesKey(feed.ID), item.GUID, contentHash(item)).Err(); err != nil {
+		log.Printf("Unable to persist content hash for %s in Redis: %v", item.GUID, err)
+	}
+}
+
+// checkUpdates compares already synced items against the content they were
+// synced with. When the issue of a changed item is known, it is closed if the
+// item now matches close_on_pattern, rewritten with the new content for
+// sync_updates feeds, or the change is added as a note. Otherwise a follow-up
+// issue is created.
+func (feed Feed) checkUpdates(items []*gofeed.Item, redisClient *redis.Client, gitlabClient *gitlab.Client) {
+	ctx := context.Background()
+
+	hashes, err := redisClient.HGetAll(ctx, contentHashesKey(feed.ID)).Result()
+	if err != nil {
+		log.Printf("Unable to read content hashes for feed %s from Redis: %v", feed.Name, err)
+		return
+	}
+
+	for _, item := range items {
+		hash := contentHash(item)
+		previous, ok := hashes[item.GUID]
+		if ok && previous == hash {
+			continue
+		}
+		if !ok {
+			// Synced before updates were tracked, start from what it is now
+			feed.rememberContent(redisClient, item)
+			continue
+		}
+		if reason := feed.filterReason(item); reason != "" {
+			// Never had an issue, nothing to update
+			feed.rememberContent(redisClient, item)
+			continue
+		}
+
+		ref, found, err := getIssueRef(ctx, redisClient, feed.ID, item.GUID)
+		if err != nil {
+			log.Printf("Unable to read issue IID for %s from Redis: %v", item.GUID, err)
+			continue
+		}
+
+		if found {
+			project, iid := ref.ProjectID, ref.IID
+			if project == 0 {
+				project = feed.GitlabProjectID
+			}
+			if feed.isResolved(item) {
+				feed.closeIssue(gitlabClient, redisClient, item, project, iid)
+				continue
+			}
+			if feed.SyncUpdates {
+				feed.updateIssue(gitlabClient, redisClient, item, project, iid)
+				continue
+			}
+			noteOptions := &gitlab.CreateIssueNoteOptions{
+				Body: gitlab.String("This item was updated in the feed:\n\n" + feed.issueDescription(item)),
+			}
+			_, _, err = gitlabClient.Notes.CreateIssueNote(project, iid, noteOptions, gitlab.WithContext(ctx))
+			if err != nil {
+				log.Printf("Unable to add update note to issue #%d for %s: %v", iid, item.Title, err)
+				continue
+			}
+			log.Printf("Added update note to issue #%d in project %d for '%s'", iid, project, item.Title)
+			feed.rememberContent(redisClient, item)
+			continue
+		}
+
+		// Follow-ups count against max_issues_per_run like any other issue,
+		// the item keeps its old hash and is looked at again next run
+		if !issueCreationBudget.take() {
+			issueCreationDeferredCounter.WithLabelValues(feed.Name).Inc()
+			continue
+		}
+		issueTime := gitlab.Ptr(time.Now())
+		if updated := itemTime(item); feed.Retroactive && updated != nil {
+			issueTime = updated
+		}
+		issueOptions, _ := feed.issueOptions(item, issueTime)
+		issueOptions.Title = gitlab.String("Updated: " + *issueOptions.Title)
+		feed.ensureLabels(gitlabClient, *issueOptions.Labels)
+		issue, err := feed.createIssue(gitlabClient, item, issueOptions)
+		if err != nil {
+			issueCreationBudget.giveBack()
+		}
+		if gitlabAvailability.record(feed.GitlabBaseURL, err) {
+			issueCreationErrorCounter.Inc()
+			log.Printf("Stopped checking %s for updates while GitLab is unavailable", feed.Name)
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to create follow-up Gitlab issue for %s: %v", item.Title, err)
+			issueCreationErrorCounter.Inc()
+			continue
+		}
+		issuesCreatedCounter.Inc()
+		log.Printf("Created follow-up Gitlab Issue '%s' (#%d) in project: %d", item.Title, issue.IID, feed.GitlabProjectID)
+		feed.rememberIssue(redisClient, item.GUID, issue)
+		feed.rememberContent(redisClient, item)
+	}
+}
+
+// updateIssue refreshes the title and description of the item's issue. The new
+// content hash is only stored once the update succeeded, so a failed update is
+// retried on the next run.
+func (feed Feed) updateIssue(gitlabClient *gitlab.Client, redisClient *redis.Client, item *gofeed.Item, project, iid int) {
+	updateOptions := &gitlab.UpdateIssueOptions{
+		Title:       gitlab.String(feed.issueTitle(item)),
+		Description: gitlab.String(feed.issueDescription(item)),
+	}
+	_, _, err := gitlabClient.Issues.UpdateIssue(project, iid, updateOptions, gitlab.WithContext(context.Background()))
+	if err != nil {
+		log.Printf("Unable to update issue #%d in project %d for %s: %v", iid, project, item.Title, err)
+		issueUpdateErrorCounter.WithLabelValues(feed.Name).Inc()
+		return
+	}
+	issuesUpdatedCounter.WithLabelValues(feed.Name).Inc()
+	log.Printf("Updated issue #%d in project %d for '%s'", iid, project, item.Title)
+	feed.rememberContent(redisClient, item)
+}
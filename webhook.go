@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-redis/redis/v9"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// maxWebhookBody bounds the size of webhook payloads read.
+const maxWebhookBody = 1 << 20
+
+// webhookHandler receives Gitlab issue events, authenticated with the
+// configured webhook_secret as the X-Gitlab-Token header. When an issue
+// created for a feed with resync_deleted is deleted, its item is forgotten so
+// the next check creates it again if it is still in the feed. Events for other
+// issues are ignored.
+func webhookHandler(config *Config, redisClient *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get("X-Gitlab-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.WebhookSecret)) != 1 {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "Unable to read the payload", http.StatusBadRequest)
+			return
+		}
+		event, err := gitlab.ParseWebhook(gitlab.HookEventType(r), payload)
+		if err != nil {
+			// Other kinds of event are fine, there is just nothing to do
+			debugf("Ignoring webhook: %v", err)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		issueEvent, ok := event.(*gitlab.IssueEvent)
+		if !ok || issueEvent.ObjectAttributes.Action != "delete" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		ref := issueRef{ProjectID: issueEvent.Project.ID, IID: issueEvent.ObjectAttributes.IID}
+		for _, feed := range config.Feeds {
+			if feed.ResyncDeleted {
+				feed.forgetIssue(r.Context(), redisClient, ref)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// forgetIssue removes the item the issue was created for from the feed's
+// synced items, along with what is remembered about it.
+func (feed Feed) forgetIssue(ctx context.Context, redisClient *redis.Client, deleted issueRef) {
+	refs, err := redisClient.HGetAll(ctx, issuesKey(feed.ID)).Result()
+	if err != nil {
+		log.Printf("Unable to read issue references of feed %s from Redis: %v", feed.Name, err)
+		return
+	}
+	for guid, value := range refs {
+		ref, err := parseIssueRef(value)
+		if err != nil {
+			continue
+		}
+		if ref.ProjectID == 0 {
+			ref.ProjectID = feed.GitlabProjectID
+		}
+		if ref != deleted {
+			continue
+		}
+		if _, err := forgetItem(ctx, redisClient, feed.ID, guid); err != nil {
+			log.Printf("Unable to forget %s of feed %s in Redis: %v", guid, feed.Name, err)
+			return
+		}
+		// The next fetch mustn't be skipped as unchanged, or it won't be
+		feed.forgetValidators(redisClient)
+		log.Printf("Issue #%d in project %d was deleted, %s of feed %s will be synced again", deleted.IID, deleted.ProjectID, guid, feed.Name)
+		return
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeletedIssueIsSyncedAgain(t *testing.T) {
+	fake := &fakeGitlab{}
+	feed, redisClient, gitlabClient := newTestSync(t, testRSS, fake)
+	feed.ResyncDeleted = true
+	config := &Config{Feeds: []Feed{feed}, WebhookSecret: "secret"}
+
+	feed.checkFeed(redisClient, gitlabClient)
+	if len(fake.created) != 1 {
+		t.Fatalf("created %v", fake.titles())
+	}
+
+	payload := `{"object_kind": "issue", "project": {"id": 1}, "object_attributes": {"iid": 1, "action": "delete"}}`
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+	req.Header.Set("X-Gitlab-Event", "Issue Hook")
+	req.Header.Set("X-Gitlab-Token", "secret")
+	recorder := httptest.NewRecorder()
+	webhookHandler(config, redisClient)(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("webhook answered %d", recorder.Code)
+	}
+
+	// The feed itself is unchanged and would answer 304 to its old ETag
+	feed.checkFeed(redisClient, gitlabClient)
+	if got := fake.titles(); len(got) != 2 {
+		t.Errorf("created %v, want the deleted issue created again", got)
+	}
+}